@@ -8,4 +8,5 @@ require (
 	github.com/gorilla/mux v1.7.3
 	github.com/spf13/cobra v0.0.5
 	gopkg.in/h2non/gock.v1 v1.0.15
+	gopkg.in/yaml.v3 v3.0.1
 )
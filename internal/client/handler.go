@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"io"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// ListHandlers writes the handlers of the requests in flight in Kapow!
+// server to w
+func ListHandlers(host string, w io.Writer) error {
+	return http.Get(host+"/handlers", "", nil, w)
+}
+
+// GetHandler writes the details of a handler in flight in Kapow! server to w
+func GetHandler(host, id string, w io.Writer) error {
+	return http.Get(host+"/handlers/"+id, "", nil, w)
+}
+
+// CancelHandler kills the processes of a handler in flight in Kapow! server
+// and aborts its request
+func CancelHandler(host, id string) error {
+	return http.Delete(host+"/handlers/"+id, "", nil, nil)
+}
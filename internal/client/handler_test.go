@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestListHandlersWritesTheHandlers(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Get("/handlers").
+		Reply(http.StatusOK).
+		BodyString(`[{"id":"FOO"}]`)
+	buf := &bytes.Buffer{}
+
+	if err := ListHandlers("http://localhost", buf); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if buf.String() != `[{"id":"FOO"}]` {
+		t.Errorf("Unexpected handlers: %q", buf.String())
+	}
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestGetHandlerWritesTheHandler(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Get("/handlers/FOO").
+		Reply(http.StatusOK).
+		BodyString(`{"id":"FOO"}`)
+	buf := &bytes.Buffer{}
+
+	if err := GetHandler("http://localhost", "FOO", buf); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if buf.String() != `{"id":"FOO"}` {
+		t.Errorf("Unexpected handler: %q", buf.String())
+	}
+}
+
+func TestCancelHandlerDeletesTheHandler(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Delete("/handlers/FOO").
+		Reply(http.StatusNoContent)
+
+	if err := CancelHandler("http://localhost", "FOO"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestCancelHandlerFailsWhenTheHandlerDoesntExist(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Delete("/handlers/FOO").
+		Reply(http.StatusNotFound).
+		JSON(map[string]string{"reason": "Handler Not Found"})
+
+	if err := CancelHandler("http://localhost", "FOO"); err == nil || err.Error() != "Handler Not Found" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -22,15 +22,24 @@ import (
 	"io"
 
 	"github.com/BBVA/kapow/internal/http"
+	"github.com/BBVA/kapow/internal/server/model"
 )
 
-// AddRoute will add a new route in kapow
-func AddRoute(host, path, method, entrypoint, command string, w io.Writer) error {
+// AddRoute will add a new route in kapow.  The id and pow file of r are
+// only sent when set, and its index is ignored.
+func AddRoute(host string, r model.Route, w io.Writer) error {
 	url := host + "/routes"
-	body, _ := json.Marshal(map[string]string{
-		"method":      method,
-		"url_pattern": path,
-		"entrypoint":  entrypoint,
-		"command":     command})
+	route := map[string]string{
+		"method":      r.Method,
+		"url_pattern": r.Pattern,
+		"entrypoint":  r.Entrypoint,
+		"command":     r.Command}
+	if r.PowFile != "" {
+		route["pow_file"] = r.PowFile
+	}
+	if r.ID != "" {
+		route["id"] = r.ID
+	}
+	body, _ := json.Marshal(route)
 	return http.Post(url, "application/json", bytes.NewReader(body), w)
 }
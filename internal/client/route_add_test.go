@@ -21,6 +21,8 @@ import (
 	"testing"
 
 	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/BBVA/kapow/internal/server/model"
 )
 
 func TestSuccessOnCorrectRoute(t *testing.T) {
@@ -38,8 +40,59 @@ func TestSuccessOnCorrectRoute(t *testing.T) {
 		JSON(map[string]string{})
 
 	err := AddRoute(
-		"http://localhost",
-		"/hello", "GET", "", "echo Hello World | kapow set /response/body", nil)
+		"http://localhost", model.Route{Method: "GET", Pattern: "/hello", Command: "echo Hello World | kapow set /response/body"}, nil)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestAddRouteSendsThePowFile(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes").
+		MatchType("json").
+		JSON(map[string]string{
+			"method":      "GET",
+			"url_pattern": "/hello",
+			"entrypoint":  "",
+			"command":     "echo Hello World | kapow set /response/body",
+			"pow_file":    "/etc/kapow/hello.pow",
+		}).
+		Reply(http.StatusCreated).
+		JSON(map[string]string{})
+
+	err := AddRoute(
+		"http://localhost", model.Route{Method: "GET", Pattern: "/hello", Command: "echo Hello World | kapow set /response/body", PowFile: "/etc/kapow/hello.pow"}, nil)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestAddRouteSendsTheID(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes").
+		MatchType("json").
+		JSON(map[string]string{
+			"id":          "hello",
+			"method":      "GET",
+			"url_pattern": "/hello",
+			"entrypoint":  "",
+			"command":     "echo Hello World | kapow set /response/body",
+		}).
+		Reply(http.StatusCreated).
+		JSON(map[string]string{})
+
+	err := AddRoute(
+		"http://localhost", model.Route{ID: "hello", Method: "GET", Pattern: "/hello", Command: "echo Hello World | kapow set /response/body"}, nil)
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -48,3 +101,16 @@ func TestSuccessOnCorrectRoute(t *testing.T) {
 		t.Error("Expected endpoint call not made")
 	}
 }
+
+func TestAddRouteFailsWhenTheIDIsInUse(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes").
+		Reply(http.StatusConflict).
+		JSON(map[string]string{"reason": "Route ID In Use"})
+
+	err := AddRoute("http://localhost", model.Route{ID: "hello", Method: "GET", Pattern: "/hello"}, nil)
+	if err == nil || err.Error() != "Route ID In Use" {
+		t.Errorf(`Error mismatch. Expected: "Route ID In Use". Got: %v`, err)
+	}
+}
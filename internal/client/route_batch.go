@@ -0,0 +1,29 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"io"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// BatchRoutes applies the list of route operations in the JSON document read
+// from r to the route table of Kapow! server, all of them at once or none
+func BatchRoutes(host string, r io.Reader, w io.Writer) error {
+	return http.Post(host+"/routes:batch", "application/json", r, w)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestBatchRoutesSendsTheOperations(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes:batch").
+		MatchType("json").
+		BodyString(`[{"op":"remove","id":"FOO"}]`).
+		Reply(http.StatusOK).
+		JSON([]string{})
+
+	if err := BatchRoutes("http://localhost", strings.NewReader(`[{"op":"remove","id":"FOO"}]`), nil); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestBatchRoutesFailsWhenTheBatchIsInvalid(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes:batch").
+		Reply(http.StatusUnprocessableEntity).
+		JSON(map[string]string{"reason": `Invalid Batch: operation 1: route "FOO" not found`})
+
+	if err := BatchRoutes("http://localhost", strings.NewReader(`[{"op":"remove","id":"FOO"}]`), nil); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
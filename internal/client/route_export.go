@@ -0,0 +1,43 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"io"
+	"net/url"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// ExportRoutes writes the whole route table of Kapow! server to w, in the
+// given format: json or pow
+func ExportRoutes(host, format string, w io.Writer) error {
+	u := host + "/routes?format=" + url.QueryEscape(format)
+	return http.Get(u, "", nil, w)
+}
+
+// ImportRoutes loads the routes in the JSON document read from r into
+// Kapow! server.  They replace the whole route table when replace is set,
+// or are merged into it otherwise.
+func ImportRoutes(host string, r io.Reader, replace bool, w io.Writer) error {
+	mode := "merge"
+	if replace {
+		mode = "replace"
+	}
+	u := host + "/routes:import?mode=" + mode
+	return http.Post(u, "application/json", r, w)
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestExportRoutesRequestsTheGivenFormat(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Get("/routes").
+		MatchParam("format", "^pow$").
+		Reply(http.StatusOK).
+		BodyString("#!/bin/sh\n")
+	buf := &bytes.Buffer{}
+
+	if err := ExportRoutes("http://localhost", "pow", buf); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if buf.String() != "#!/bin/sh\n" {
+		t.Errorf("Unexpected export: %q", buf.String())
+	}
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestImportRoutesSendsTheDocument(t *testing.T) {
+	testCases := map[bool]string{false: "merge", true: "replace"}
+	for replace, mode := range testCases {
+		gock.New("http://localhost").
+			Post("/routes:import").
+			MatchParam("mode", "^"+mode+"$").
+			MatchType("json").
+			BodyString(`[{"method":"GET","url_pattern":"/hello"}]`).
+			Reply(http.StatusOK).
+			JSON([]string{})
+
+		err := ImportRoutes("http://localhost", strings.NewReader(`[{"method":"GET","url_pattern":"/hello"}]`), replace, nil)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		if !gock.IsDone() {
+			t.Errorf("Expected endpoint call not made for mode %s", mode)
+		}
+		gock.Off()
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestGetRouteWritesTheRoute(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Get("/routes/hello").
+		Reply(http.StatusOK).
+		BodyString(`{"id":"hello"}`)
+	buf := &bytes.Buffer{}
+
+	if err := GetRoute("http://localhost", "hello", buf); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if buf.String() != `{"id":"hello"}` {
+		t.Errorf("Unexpected route: %q", buf.String())
+	}
+}
+
+func TestGetRouteFailsWhenTheRouteDoesntExist(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Get("/routes/hello").
+		Reply(http.StatusNotFound).
+		JSON(map[string]string{"reason": "Route Not Found"})
+
+	err := GetRoute("http://localhost", "hello", nil)
+	if err == nil || err.Error() != "Route Not Found" {
+		t.Errorf(`Error mismatch. Expected: "Route Not Found". Got: %v`, err)
+	}
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// GetHistory writes the last changes made to the route table of Kapow!
+// server to w, as a JSON document
+func GetHistory(host string, w io.Writer) error {
+	return http.Get(host+"/routes/history", "", nil, w)
+}
+
+// RollbackRoutes restores the route table of Kapow! server as it was right
+// after the given version of the history
+func RollbackRoutes(host string, version int, w io.Writer) error {
+	u := host + "/routes/rollback?version=" + strconv.Itoa(version)
+	return http.Post(u, "", nil, w)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestGetHistoryWritesTheHistory(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Get("/routes/history").
+		Reply(http.StatusOK).
+		BodyString(`[{"version":1}]`)
+	buf := &bytes.Buffer{}
+
+	if err := GetHistory("http://localhost", buf); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if buf.String() != `[{"version":1}]` {
+		t.Errorf("Unexpected history: %q", buf.String())
+	}
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestRollbackRoutesSendsTheVersion(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes/rollback").
+		MatchParam("version", "^3$").
+		Reply(http.StatusOK).
+		JSON([]string{})
+
+	if err := RollbackRoutes("http://localhost", 3, nil); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestRollbackRoutesFailsOnUnknownVersion(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes/rollback").
+		Reply(http.StatusNotFound).
+		JSON(map[string]string{"reason": "Version Not Found"})
+
+	if err := RollbackRoutes("http://localhost", 42, nil); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
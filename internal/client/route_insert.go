@@ -0,0 +1,47 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/BBVA/kapow/internal/http"
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// InsertRoute will insert a new route in kapow at the position of the route
+// list given by the index of r.  The id and pow file of r are only sent when
+// set.
+func InsertRoute(host string, r model.Route, w io.Writer) error {
+	url := host + "/routes"
+	route := map[string]interface{}{
+		"method":      r.Method,
+		"url_pattern": r.Pattern,
+		"entrypoint":  r.Entrypoint,
+		"command":     r.Command,
+		"index":       r.Index}
+	if r.PowFile != "" {
+		route["pow_file"] = r.PowFile
+	}
+	if r.ID != "" {
+		route["id"] = r.ID
+	}
+	body, _ := json.Marshal(route)
+	return http.Put(url, "application/json", bytes.NewReader(body), w)
+}
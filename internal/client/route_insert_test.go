@@ -0,0 +1,118 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestInsertRouteSendsTheIndex(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Put("/routes").
+		MatchType("json").
+		JSON(map[string]interface{}{
+			"method":      "GET",
+			"url_pattern": "/hello",
+			"entrypoint":  "",
+			"command":     "echo Hello World | kapow set /response/body",
+			"index":       2,
+		}).
+		Reply(http.StatusCreated).
+		JSON(map[string]string{})
+
+	err := InsertRoute(
+		"http://localhost", model.Route{Method: "GET", Pattern: "/hello", Command: "echo Hello World | kapow set /response/body", Index: 2}, nil)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestInsertRouteFailsWhenServerRejectsTheIndex(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Put("/routes").
+		Reply(http.StatusUnprocessableEntity).
+		JSON(map[string]string{"reason": "Invalid Route"})
+
+	err := InsertRoute("http://localhost", model.Route{Method: "GET", Pattern: "/hello", Index: -1}, nil)
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestInsertRouteSendsTheID(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Put("/routes").
+		MatchType("json").
+		JSON(map[string]interface{}{
+			"id":          "hello",
+			"method":      "GET",
+			"url_pattern": "/hello",
+			"entrypoint":  "",
+			"command":     "",
+			"index":       0,
+		}).
+		Reply(http.StatusCreated).
+		JSON(map[string]string{})
+
+	err := InsertRoute("http://localhost", model.Route{ID: "hello", Method: "GET", Pattern: "/hello"}, nil)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestInsertRouteSendsThePowFile(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Put("/routes").
+		MatchType("json").
+		JSON(map[string]interface{}{
+			"method":      "GET",
+			"url_pattern": "/hello",
+			"entrypoint":  "",
+			"command":     "",
+			"index":       0,
+			"pow_file":    "/etc/kapow/hello.pow",
+		}).
+		Reply(http.StatusCreated).
+		JSON(map[string]string{})
+
+	err := InsertRoute(
+		"http://localhost", model.Route{Method: "GET", Pattern: "/hello", PowFile: "/etc/kapow/hello.pow"}, nil)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
@@ -27,3 +27,11 @@ func ListRoutes(host string, w io.Writer) error {
 	url := host + "/routes"
 	return http.Get(url, "", nil, w)
 }
+
+// WatchRoutes writes to w the routes registered in the kapow! instance and
+// then every change made to them, as JSON lines, until the server ends the
+// watch
+func WatchRoutes(host string, w io.Writer) error {
+	url := host + "/routes?watch=true"
+	return http.Get(url, "", nil, w)
+}
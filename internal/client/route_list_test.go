@@ -64,3 +64,24 @@ func TestListRoutesOKSome(t *testing.T) {
 		t.Errorf("No endpoint called")
 	}
 }
+
+func TestWatchRoutesWritesTheEvents(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost:8080").
+		Get("/routes").
+		MatchParam("watch", "^true$").
+		Reply(http.StatusOK).
+		BodyString(`{"revision":0,"operation":"snapshot","routes":[]}` + "\n")
+
+	var b bytes.Buffer
+	if err := WatchRoutes("http://localhost:8080", &b); err != nil {
+		t.Errorf("Unexpected error: %q", err)
+	}
+
+	if b.String() != `{"revision":0,"operation":"snapshot","routes":[]}`+"\n" {
+		t.Errorf("Unexpected events: %q", b.String())
+	}
+	if !gock.IsDone() {
+		t.Errorf("No endpoint called")
+	}
+}
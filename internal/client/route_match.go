@@ -0,0 +1,36 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// MatchRoute asks kapow for the route that would serve a request with the
+// given method, URL and headers, without running it
+func MatchRoute(host, method, url string, headers map[string]string, w io.Writer) error {
+	request := map[string]interface{}{
+		"method":  method,
+		"url":     url,
+		"headers": headers}
+	body, _ := json.Marshal(request)
+	return http.Post(host+"/routes:match", "application/json", bytes.NewReader(body), w)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestMatchRouteSendsTheRequest(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes:match").
+		MatchType("json").
+		JSON(map[string]interface{}{
+			"method":  "GET",
+			"url":     "/foo/bar",
+			"headers": map[string]string{"X-Foo": "bar"},
+		}).
+		Reply(http.StatusOK).
+		JSON(map[string]string{})
+
+	if err := MatchRoute("http://localhost", "GET", "/foo/bar", map[string]string{"X-Foo": "bar"}, nil); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("Expected endpoint call not made")
+	}
+}
+
+func TestMatchRouteFailsWhenNoRouteMatches(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/routes:match").
+		Reply(http.StatusNotFound).
+		JSON(map[string]string{"reason": "No Match"})
+
+	err := MatchRoute("http://localhost", "GET", "/foo", nil, nil)
+	if err == nil || err.Error() != "No Match" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
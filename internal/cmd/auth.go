@@ -0,0 +1,35 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// configureControlToken makes the HTTP client authenticate to the control
+// interface with the token in KAPOW_CONTROL_TOKEN, if any
+func configureControlToken() {
+	http.SetBearerToken(os.Getenv("KAPOW_CONTROL_TOKEN"))
+}
+
+// configureHandlerSecret makes the HTTP client authenticate to the data
+// interface with the secret in KAPOW_HANDLER_SECRET, if any
+func configureHandlerSecret() {
+	http.SetBearerToken(os.Getenv("KAPOW_HANDLER_SECRET"))
+}
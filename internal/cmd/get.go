@@ -33,6 +33,11 @@ var GetCmd = &cobra.Command{
 	Args:    cobra.ExactArgs(1),
 	PreRunE: handlerIDRequired,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := configureClientTLS(cmd); err != nil {
+			log.Fatal(err)
+		}
+		configureHandlerSecret()
+
 		dataURL, _ := cmd.Flags().GetString("data-url")
 		handler, _ := cmd.Flags().GetString("handler")
 
@@ -46,4 +51,5 @@ var GetCmd = &cobra.Command{
 func init() {
 	GetCmd.Flags().String("data-url", getEnv("KAPOW_DATA_URL", "http://localhost:8082"), "Kapow! data interface URL")
 	GetCmd.Flags().String("handler", getEnv("KAPOW_HANDLER_ID", ""), "Kapow! handler ID")
+	addClientTLSFlags(GetCmd)
 }
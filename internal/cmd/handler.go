@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/BBVA/kapow/internal/client"
+
+	"github.com/spf13/cobra"
+)
+
+// HandlerCmd is the command line interface for inspecting and cancelling
+// the handlers of the requests in flight
+var HandlerCmd = &cobra.Command{
+	Use: "handler [action]",
+}
+
+func init() {
+	var handlerListCmd = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List the handlers of the requests in flight",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			if err := client.ListHandlers(controlURL, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	handlerListCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(handlerListCmd)
+
+	var handlerGetCmd = &cobra.Command{
+		Use:   "get [flags] handler_id",
+		Short: "Show the given handler and its route",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			if err := client.GetHandler(controlURL, args[0], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	handlerGetCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(handlerGetCmd)
+
+	var handlerCancelCmd = &cobra.Command{
+		Use:   "cancel [flags] handler_id",
+		Short: "Kill the processes of the given handler and abort its request",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			if err := client.CancelHandler(controlURL, args[0]); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	handlerCancelCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(handlerCancelCmd)
+
+	HandlerCmd.AddCommand(handlerListCmd)
+	HandlerCmd.AddCommand(handlerGetCmd)
+	HandlerCmd.AddCommand(handlerCancelCmd)
+}
@@ -17,11 +17,15 @@
 package cmd
 
 import (
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/BBVA/kapow/internal/client"
+	"github.com/BBVA/kapow/internal/server/model"
 
 	"github.com/spf13/cobra"
 )
@@ -36,6 +40,10 @@ func init() {
 		Use:   "list [flags]",
 		Short: "List the current Kapow! routes",
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
 			controlURL, _ := cmd.Flags().GetString("control-url")
 
 			if err := client.ListRoutes(controlURL, os.Stdout); err != nil {
@@ -44,6 +52,26 @@ func init() {
 		},
 	}
 	routeListCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeListCmd)
+
+	var routeWatchCmd = &cobra.Command{
+		Use:   "watch [flags]",
+		Short: "Print the current Kapow! routes and then every change made to them, as JSON lines",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			if err := client.WatchRoutes(controlURL, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeWatchCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeWatchCmd)
 
 	// TODO: Manage args for url_pattern and command_file (2 exact args)
 	var routeAddCmd = &cobra.Command{
@@ -51,43 +79,307 @@ func init() {
 		Short: "Add a route",
 		Args:  cobra.RangeArgs(1, 2),
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
 			controlURL, _ := cmd.Flags().GetString("control-url")
 			method, _ := cmd.Flags().GetString("method")
 			command, _ := cmd.Flags().GetString("command")
 			entrypoint, _ := cmd.Flags().GetString("entrypoint")
+			powFile, _ := cmd.Flags().GetString("pow-file")
+			id, _ := cmd.Flags().GetString("id")
 			urlPattern := args[0]
 
-			if len(args) > 1 && command == "" {
-				commandFile := args[1]
-				var buf []byte
-				var err error
-				if commandFile == "-" {
-					buf, err = ioutil.ReadAll(os.Stdin)
-				} else {
-					buf, err = ioutil.ReadFile(commandFile)
-				}
-				if err != nil {
-					log.Fatal(err)
-				}
-				command = string(buf)
+			command, err := routeCommand(args, command)
+			if err != nil {
+				log.Fatal(err)
 			}
 
-			if err := client.AddRoute(controlURL, urlPattern, method, entrypoint, command, os.Stdout); err != nil {
+			route := model.Route{
+				ID:         id,
+				Method:     method,
+				Pattern:    urlPattern,
+				Entrypoint: entrypoint,
+				Command:    command,
+				PowFile:    powFile,
+			}
+			if err := client.AddRoute(controlURL, route, os.Stdout); err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
 	// TODO: Add default values for flags and remove path flag
 	routeAddCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeAddCmd)
 	routeAddCmd.Flags().StringP("method", "X", "GET", "HTTP method to accept")
 	routeAddCmd.Flags().StringP("entrypoint", "e", "/bin/sh -c", "Command to execute")
 	routeAddCmd.Flags().StringP("command", "c", "", "Command to pass to the shell")
+	routeAddCmd.Flags().String("pow-file", getEnv("KAPOW_POW_FILE", ""), "Pow file owning the route")
+	routeAddCmd.Flags().String("id", "", "Id of the route, to refer to it later; a random one is generated if not given")
+
+	var routeInsertCmd = &cobra.Command{
+		Use:   "insert [flags] url_pattern [command_file]",
+		Short: "Insert a route at the given position",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+			method, _ := cmd.Flags().GetString("method")
+			command, _ := cmd.Flags().GetString("command")
+			entrypoint, _ := cmd.Flags().GetString("entrypoint")
+			index, _ := cmd.Flags().GetInt("index")
+			powFile, _ := cmd.Flags().GetString("pow-file")
+			id, _ := cmd.Flags().GetString("id")
+			urlPattern := args[0]
+
+			command, err := routeCommand(args, command)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			route := model.Route{
+				ID:         id,
+				Method:     method,
+				Pattern:    urlPattern,
+				Entrypoint: entrypoint,
+				Command:    command,
+				Index:      index,
+				PowFile:    powFile,
+			}
+			if err := client.InsertRoute(controlURL, route, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeInsertCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeInsertCmd)
+	routeInsertCmd.Flags().StringP("method", "X", "GET", "HTTP method to accept")
+	routeInsertCmd.Flags().StringP("entrypoint", "e", "/bin/sh -c", "Command to execute")
+	routeInsertCmd.Flags().StringP("command", "c", "", "Command to pass to the shell")
+	routeInsertCmd.Flags().IntP("index", "i", 0, "Position of the route in the route list, starting at 0")
+	routeInsertCmd.Flags().String("pow-file", getEnv("KAPOW_POW_FILE", ""), "Pow file owning the route")
+	routeInsertCmd.Flags().String("id", "", "Id of the route, to refer to it later; a random one is generated if not given")
+
+	var routeUpdateCmd = &cobra.Command{
+		Use:   "update [flags] route_id [command_file]",
+		Short: "Change the given route, keeping its id and position",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+			command, _ := cmd.Flags().GetString("command")
+
+			fields := map[string]string{}
+			for flag, field := range map[string]string{
+				"method":      "method",
+				"url-pattern": "url_pattern",
+				"entrypoint":  "entrypoint",
+				"command":     "command",
+			} {
+				if cmd.Flags().Changed(flag) {
+					fields[field], _ = cmd.Flags().GetString(flag)
+				}
+			}
+			if len(args) > 1 && command == "" {
+				command, err := routeCommand(args, command)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fields["command"] = command
+			}
+
+			if err := client.UpdateRoute(controlURL, args[0], fields, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeUpdateCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeUpdateCmd)
+	routeUpdateCmd.Flags().StringP("method", "X", "", "HTTP method to accept")
+	routeUpdateCmd.Flags().StringP("url-pattern", "p", "", "URL pattern to match")
+	routeUpdateCmd.Flags().StringP("entrypoint", "e", "", "Command to execute")
+	routeUpdateCmd.Flags().StringP("command", "c", "", "Command to pass to the shell")
+
+	var routeExportCmd = &cobra.Command{
+		Use:   "export [flags]",
+		Short: "Write the whole route table to the standard output",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+			format, _ := cmd.Flags().GetString("format")
+
+			if err := client.ExportRoutes(controlURL, format, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeExportCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeExportCmd)
+	routeExportCmd.Flags().StringP("format", "f", "json", "Format of the route table: json, or pow for a pow file adding the routes")
+
+	var routeImportCmd = &cobra.Command{
+		Use:   "import [flags] [routes_file]",
+		Short: "Load the routes of a file written by kapow route export --format json",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+			replace, _ := cmd.Flags().GetBool("replace")
+
+			r, err := inputFile(args)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer r.Close()
+
+			if err := client.ImportRoutes(controlURL, r, replace, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeImportCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeImportCmd)
+	routeImportCmd.Flags().Bool("replace", false, "Replace the whole route table instead of merging the routes into it")
+
+	var routeBatchCmd = &cobra.Command{
+		Use:   "batch [flags] [operations_file]",
+		Short: "Apply a list of route operations all at once, or none if any of them is invalid",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			r, err := inputFile(args)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer r.Close()
+
+			if err := client.BatchRoutes(controlURL, r, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeBatchCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeBatchCmd)
+
+	var routeMatchCmd = &cobra.Command{
+		Use:   "match [flags] method url",
+		Short: "Show the route that would serve the given request, without running it",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+			headerList, _ := cmd.Flags().GetStringArray("header")
+
+			headers := map[string]string{}
+			for _, h := range headerList {
+				parts := strings.SplitN(h, ":", 2)
+				if len(parts) != 2 {
+					log.Fatalf("Invalid header %q, expected name: value", h)
+				}
+				headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+
+			if err := client.MatchRoute(controlURL, args[0], args[1], headers, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeMatchCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeMatchCmd)
+	routeMatchCmd.Flags().StringArrayP("header", "H", nil, "Header of the request, as name: value")
+
+	var routeHistoryCmd = &cobra.Command{
+		Use:   "history [flags]",
+		Short: "List the last changes made to the route table",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			if err := client.GetHistory(controlURL, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeHistoryCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeHistoryCmd)
+
+	var routeRollbackCmd = &cobra.Command{
+		Use:   "rollback [flags] version",
+		Short: "Restore the route table as it was right after the given version of the history",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+			version, err := strconv.Atoi(args[0])
+			if err != nil {
+				log.Fatalf("Invalid version %q", args[0])
+			}
+
+			if err := client.RollbackRoutes(controlURL, version, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeRollbackCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeRollbackCmd)
+
+	var routeGetCmd = &cobra.Command{
+		Use:   "get [flags] route_id",
+		Short: "Show the given route",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
+			controlURL, _ := cmd.Flags().GetString("control-url")
+
+			if err := client.GetRoute(controlURL, args[0], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+	routeGetCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeGetCmd)
 
 	var routeRemoveCmd = &cobra.Command{
 		Use:   "remove [flags] route_id",
 		Short: "Remove the given route",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := configureClientTLS(cmd); err != nil {
+				log.Fatal(err)
+			}
+			configureControlToken()
 			controlURL, _ := cmd.Flags().GetString("control-url")
 
 			if err := client.RemoveRoute(controlURL, args[0]); err != nil {
@@ -96,8 +388,49 @@ func init() {
 		},
 	}
 	routeRemoveCmd.Flags().String("control-url", getEnv("KAPOW_CONTROL_URL", "http://localhost:8081"), "Kapow! control interface URL")
+	addClientTLSFlags(routeRemoveCmd)
 
 	RouteCmd.AddCommand(routeListCmd)
+	RouteCmd.AddCommand(routeWatchCmd)
 	RouteCmd.AddCommand(routeAddCmd)
+	RouteCmd.AddCommand(routeInsertCmd)
+	RouteCmd.AddCommand(routeUpdateCmd)
+	RouteCmd.AddCommand(routeExportCmd)
+	RouteCmd.AddCommand(routeImportCmd)
+	RouteCmd.AddCommand(routeBatchCmd)
+	RouteCmd.AddCommand(routeMatchCmd)
+	RouteCmd.AddCommand(routeHistoryCmd)
+	RouteCmd.AddCommand(routeRollbackCmd)
+	RouteCmd.AddCommand(routeGetCmd)
 	RouteCmd.AddCommand(routeRemoveCmd)
 }
+
+// routeCommand returns the command of a route, read from the command file
+// given in args when no command was given with a flag.  The command file "-"
+// stands for stdin.
+func routeCommand(args []string, command string) (string, error) {
+	if len(args) < 2 || command != "" {
+		return command, nil
+	}
+
+	var buf []byte
+	var err error
+	if args[1] == "-" {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		buf, err = ioutil.ReadFile(args[1])
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// inputFile opens the file named by the first argument, or returns the
+// standard input if there is none or it is -
+func inputFile(args []string) (io.ReadCloser, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(args[0])
+}
@@ -17,15 +17,27 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/BBVA/kapow/internal/config"
+	"github.com/BBVA/kapow/internal/powfile"
 	"github.com/BBVA/kapow/internal/server"
+	"github.com/BBVA/kapow/internal/server/accesslog"
+	"github.com/BBVA/kapow/internal/server/control"
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/user"
 )
 
 // ServerCmd is the command line interface for kapow server
@@ -34,49 +46,258 @@ var ServerCmd = &cobra.Command{
 	Short: "Start a kapow server",
 	Long: `Start a Kapow server with, by default with client interface, data interface
 	and admin interface`,
-	PreRunE: validateServerCommandArguments,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadServerConfigFile(cmd); err != nil {
+			return err
+		}
+		return validateServerCommandArguments(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		// cert, _ := cmd.Flags().GetString("certfile")
-		// key, _ := cmd.Flags().GetString("keyfile")
+		sConf := server.ServerConfig{}
+		sConf.CertFile, _ = cmd.Flags().GetString("certfile")
+		sConf.KeyFile, _ = cmd.Flags().GetString("keyfile")
+		sConf.RedirectBindAddr, _ = cmd.Flags().GetString("redirect-bind")
+
+		sConf.UserBindAddr, _ = cmd.Flags().GetString("bind")
+		sConf.ControlBindAddr, _ = cmd.Flags().GetString("control-bind")
+		sConf.DataBindAddr, _ = cmd.Flags().GetString("data-bind")
+		sConf.HealthBindAddr, _ = cmd.Flags().GetString("health-bind")
+		sConf.AccessLogPath, _ = cmd.Flags().GetString("access-log")
+		sConf.AccessLogFormat, _ = cmd.Flags().GetString("access-log-format")
+		sConf.OTLPEndpoint, _ = cmd.Flags().GetString("otlp-endpoint")
+		sConf.HandlerSecrets, _ = cmd.Flags().GetBool("handler-secrets")
+
+		sConf.ControlCertFile, _ = cmd.Flags().GetString("control-certfile")
+		sConf.ControlKeyFile, _ = cmd.Flags().GetString("control-keyfile")
+		sConf.ControlCAFile, _ = cmd.Flags().GetString("control-cafile")
+		sConf.DataCertFile, _ = cmd.Flags().GetString("data-certfile")
+		sConf.DataKeyFile, _ = cmd.Flags().GetString("data-keyfile")
+		sConf.DataCAFile, _ = cmd.Flags().GetString("data-cafile")
+		sConf.HandlerCertFile, _ = cmd.Flags().GetString("handler-certfile")
+		sConf.HandlerKeyFile, _ = cmd.Flags().GetString("handler-keyfile")
+		sConf.HandlerCAFile, _ = cmd.Flags().GetString("handler-cafile")
+
+		controlMode, _ := cmd.Flags().GetString("control-socket-mode")
+		dataMode, _ := cmd.Flags().GetString("data-socket-mode")
+		sConf.ControlSocketMode, _ = parseFileMode(controlMode)
+		sConf.DataSocketMode, _ = parseFileMode(dataMode)
 
-		userBind, _ := cmd.Flags().GetString("bind")
-		controlBind, _ := cmd.Flags().GetString("control-bind")
-		dataBind, _ := cmd.Flags().GetString("data-bind")
+		shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		powShell, _ := cmd.Flags().GetString("pow-shell")
 
-		go server.StartServer(controlBind, dataBind, userBind)
+		warnShadowed, _ := cmd.Flags().GetBool("warn-shadowed-routes")
+		control.SetShadowWarnings(warnShadowed)
 
-		// start sub shell + ENV(KAPOW_CONTROL_URL)
-		if len(args) > 0 {
-			powfile := args[0]
-			_, err := os.Stat(powfile)
-			if os.IsNotExist(err) {
-				log.Fatalf("%s does not exist", powfile)
+		env := []string{
+			"KAPOW_CONTROL_URL=" + sConf.ControlURL(),
+			"KAPOW_DATA_URL=" + sConf.DataURL(),
+		}
+		env = append(env, sConf.ClientEnv()...)
+
+		// The pow files get an admin token of their own, so they can add
+		// routes whatever the tokens in the file are
+		if tokensFile, _ := cmd.Flags().GetString("control-tokens-file"); tokensFile != "" {
+			tokens, err := control.LoadTokens(tokensFile)
+			if err != nil {
+				log.Fatal(err)
 			}
-			log.Printf("Running powfile: %q\n", powfile)
-			kapowCMD := exec.Command("bash", powfile)
-			kapowCMD.Stdout = os.Stdout
-			kapowCMD.Stderr = os.Stderr
-			kapowCMD.Env = append(os.Environ(), "KAPOW_CONTROL_URL=http://"+controlBind)
+			powToken, err := control.NewToken()
+			if err != nil {
+				log.Fatal(err)
+			}
+			control.SetTokens(append(tokens, control.Token{Value: powToken, Role: control.RoleAdmin, Name: "pow files"}))
+			env = append(env, "KAPOW_CONTROL_TOKEN="+powToken)
+		}
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+		// A signal received while starting up kills the pow file being run
+		// and makes the server exit instead of serving
+		startup, interrupt := context.WithCancel(context.Background())
+		started, interrupted := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(interrupted)
+			select {
+			case sig := <-sigs:
+				log.Printf("Received %s while starting up", sig)
+				interrupt()
+			case <-started:
+			}
+		}()
+		errs, err := server.StartServer(sConf)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			err = kapowCMD.Run()
+		// The routes saved in the state file go first, and then the ones of
+		// the configuration and pow files are added after them
+		if stateFile, _ := cmd.Flags().GetString("state-file"); stateFile != "" {
+			saved, err := user.LoadState(stateFile)
 			if err != nil {
 				log.Fatal(err)
 			}
-			fmt.Println()
-			log.Printf("Done running powfile: %q\n", powfile)
+			for _, r := range saved {
+				if err := control.ValidateRoute(r); err != nil {
+					log.Fatalf("%s: invalid route %q: %s", stateFile, r.ID, err)
+				}
+			}
+			if err := control.AddRoutes(saved); err != nil {
+				log.Fatalf("%s: %s", stateFile, err)
+			}
+			if err := user.Routes.Persist(stateFile); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Restored %d routes from %q\n", len(saved), stateFile)
 		}
 
-		select {}
+		if len(configRoutes) > 0 {
+			if err := control.AddRoutes(configRoutes); err != nil {
+				configFile, _ := cmd.Flags().GetString("config")
+				log.Fatalf("%s: %s", configFile, err)
+			}
+			log.Printf("Added %d routes from the configuration file\n", len(configRoutes))
+		}
+
+		// Pow files are identified by their absolute path, so the routes
+		// they own are found again when they are reloaded
+		powFiles := make([]string, len(args))
+		for i, arg := range args {
+			if powFiles[i], err = filepath.Abs(arg); err != nil {
+				log.Fatal(err)
+			}
+		}
+		loadPowFile := func(ctx context.Context, path string) error {
+			return user.Routes.Reload(path, func() error {
+				return powfile.Run(ctx, path, powShell, env)
+			})
+		}
+
+		// The user interface is not started until every pow file has run,
+		// so requests are never served with a half-built route table
+		if len(powFiles) > 0 {
+			log.Printf("Running pow files: %q\n", args)
+			err := powfile.RunAll(powFiles, func(path string) error {
+				return loadPowFile(startup, path)
+			})
+			if startup.Err() != nil {
+				log.Fatal("Startup interrupted")
+			} else if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Done running pow files: %q\n", args)
+		}
+
+		if watch, _ := cmd.Flags().GetBool("watch"); watch && len(powFiles) > 0 {
+			interval, _ := cmd.Flags().GetDuration("watch-interval")
+			go powfile.Watch(powFiles, interval, nil, func(path string) {
+				log.Printf("Reloading pow file: %q\n", path)
+				if err := loadPowFile(context.Background(), path); err != nil {
+					log.Printf("Reload of pow file %q failed, keeping its previous routes: %s", path, err)
+				} else {
+					log.Printf("Done reloading pow file: %q\n", path)
+				}
+			})
+		}
+
+		close(started)
+		<-interrupted
+		if startup.Err() != nil {
+			log.Fatal("Startup interrupted")
+		}
+
+		if err := server.StartUserServer(sConf); err != nil {
+			log.Fatal(err)
+		}
+
+		select {
+		case err := <-errs:
+			log.Fatal(err)
+		case sig := <-sigs:
+			log.Printf("Received %s, waiting up to %s for running handlers to finish", sig, shutdownTimeout)
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Fatal(err)
+			}
+			log.Println("Shutdown complete")
+		}
 	},
 }
 
 func init() {
+	ServerCmd.Flags().String("config", getEnv("KAPOW_CONFIG", ""), "YAML file with the server settings and its initial routes")
 	ServerCmd.Flags().String("certfile", "", "Cert file to serve thru https")
 	ServerCmd.Flags().String("keyfile", "", "Key file to serve thru https")
+	ServerCmd.Flags().String("redirect-bind", "", "IP address and port to bind an HTTP to HTTPS redirection server to")
 
 	ServerCmd.Flags().String("bind", "0.0.0.0:8080", "IP address and port to bind the user interface to")
-	ServerCmd.Flags().String("control-bind", "localhost:8081", "IP address and port to bind the control interface to")
-	ServerCmd.Flags().String("data-bind", "localhost:8082", "IP address and port to bind the data interface to")
+	ServerCmd.Flags().String("control-bind", "localhost:8081", "IP address and port, or unix:path of a socket, to bind the control interface to")
+	ServerCmd.Flags().String("data-bind", "localhost:8082", "IP address and port, or unix:path of a socket, to bind the data interface to")
+	ServerCmd.Flags().String("health-bind", "", "IP address and port to serve the health and metrics endpoints to, besides the control interface")
+	ServerCmd.Flags().String("control-socket-mode", "0600", "Permissions of the control interface socket when bound to a unix:path")
+	ServerCmd.Flags().String("data-socket-mode", "0600", "Permissions of the data interface socket when bound to a unix:path")
+	ServerCmd.Flags().String("access-log", "", "File to write a line for every user request to, or - for the standard output; reopened on SIGHUP")
+	ServerCmd.Flags().String("access-log-format", "common", "Format of the access log lines: common, combined or json")
+	ServerCmd.Flags().String("otlp-endpoint", getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "Base URL of the OTLP/HTTP collector to export the traces to")
+	ServerCmd.Flags().Bool("warn-shadowed-routes", false, "Warn when a new route can't be matched because of an earlier one")
+	ServerCmd.Flags().String("state-file", getEnv("KAPOW_STATE_FILE", ""), "File to save the routes added thru the control interface to, and restore them from on start")
+	ServerCmd.Flags().String("pow-shell", "", "Interpreter for the pow files; by default the one in their shebang line or bash")
+	ServerCmd.Flags().Bool("watch", false, "Reload the pow files when they change")
+	ServerCmd.Flags().Duration("watch-interval", time.Second, "How often to check the pow files for changes when watching them")
+	ServerCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "Time to wait for running handlers to finish when stopping the server")
+
+	ServerCmd.Flags().Bool("handler-secrets", false, "Require a per-handler secret on every call to the data interface")
+	ServerCmd.Flags().String("control-tokens-file", "", "File with the bearer tokens, and their read-only or admin role, accepted by the control interface")
+	ServerCmd.Flags().String("control-certfile", "", "Cert file to serve the control interface thru https")
+	ServerCmd.Flags().String("control-keyfile", "", "Key file to serve the control interface thru https")
+	ServerCmd.Flags().String("control-cafile", "", "CA bundle to verify the client certificates of the control interface")
+	ServerCmd.Flags().String("data-certfile", "", "Cert file to serve the data interface thru https")
+	ServerCmd.Flags().String("data-keyfile", "", "Key file to serve the data interface thru https")
+	ServerCmd.Flags().String("data-cafile", "", "CA bundle to verify the client certificates of the data interface")
+	ServerCmd.Flags().String("handler-certfile", "", "Client cert file given to the spawned handlers and pow files for the control and data interfaces")
+	ServerCmd.Flags().String("handler-keyfile", "", "Client key file given to the spawned handlers and pow files for the control and data interfaces")
+	ServerCmd.Flags().String("handler-cafile", "", "CA bundle given to the spawned handlers and pow files to verify the control and data interfaces")
+}
+
+// configRoutes are the initial routes read from the configuration file
+var configRoutes []model.Route
+
+// loadServerConfigFile applies the settings of the configuration file to
+// the flags not given in the command line and keeps its routes for later
+func loadServerConfigFile(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("config")
+	if path == "" {
+		return nil
+	}
+
+	c, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range c.Settings {
+		if cmd.Flags().Lookup(s.Name) == nil || s.Name == "config" {
+			return &config.Error{Path: path, Line: s.Line, Msg: fmt.Sprintf("unknown setting %q", s.Name)}
+		}
+		if cmd.Flags().Changed(s.Name) {
+			continue
+		}
+		if err := cmd.Flags().Set(s.Name, s.Value); err != nil {
+			return &config.Error{Path: path, Line: s.Line, Msg: fmt.Sprintf("invalid %s: %s", s.Name, err)}
+		}
+	}
+	// The routes are owned by the configuration file, as the ones of a pow
+	// file, so they are not saved to the state file
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for i := range c.Routes {
+		c.Routes[i].PowFile = abs
+	}
+	configRoutes = c.Routes
+
+	return nil
 }
 
 func validateServerCommandArguments(cmd *cobra.Command, args []string) error {
@@ -85,5 +306,39 @@ func validateServerCommandArguments(cmd *cobra.Command, args []string) error {
 	if (cert == "") != (key == "") {
 		return errors.New("expected both or neither (certfile and keyfile)")
 	}
+	format, _ := cmd.Flags().GetString("access-log-format")
+	if _, err := accesslog.ParseFormat(format); err != nil {
+		return err
+	}
+	redirect, _ := cmd.Flags().GetString("redirect-bind")
+	if redirect != "" && cert == "" {
+		return errors.New("redirect-bind requires certfile and keyfile")
+	}
+
+	for _, iface := range []string{"control", "data"} {
+		cert, _ := cmd.Flags().GetString(iface + "-certfile")
+		key, _ := cmd.Flags().GetString(iface + "-keyfile")
+		ca, _ := cmd.Flags().GetString(iface + "-cafile")
+		if (cert == "") != (key == "") || (cert == "") != (ca == "") {
+			return fmt.Errorf("expected all or none (%[1]s-certfile, %[1]s-keyfile and %[1]s-cafile)", iface)
+		}
+		bind, _ := cmd.Flags().GetString(iface + "-bind")
+		if strings.HasPrefix(bind, "unix:") && cert != "" {
+			return fmt.Errorf("%[1]s-certfile can't be used with a unix socket %[1]s-bind", iface)
+		}
+		mode, _ := cmd.Flags().GetString(iface + "-socket-mode")
+		if _, err := parseFileMode(mode); err != nil {
+			return fmt.Errorf("invalid %s-socket-mode %q", iface, mode)
+		}
+	}
 	return nil
 }
+
+// parseFileMode parses an octal file mode such as "0660"
+func parseFileMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, errors.New("invalid file mode")
+	}
+	return os.FileMode(m), nil
+}
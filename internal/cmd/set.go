@@ -35,6 +35,11 @@ var SetCmd = &cobra.Command{
 	Args:    cobra.RangeArgs(1, 2),
 	PreRunE: handlerIDRequired,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := configureClientTLS(cmd); err != nil {
+			log.Fatal(err)
+		}
+		configureHandlerSecret()
+
 		var r io.Reader
 		dataURL, _ := cmd.Flags().GetString("data-url")
 		handler, _ := cmd.Flags().GetString("handler")
@@ -55,4 +60,5 @@ var SetCmd = &cobra.Command{
 func init() {
 	SetCmd.Flags().String("data-url", getEnv("KAPOW_DATA_URL", "http://localhost:8082"), "Kapow! data interface URL")
 	SetCmd.Flags().String("handler", getEnv("KAPOW_HANDLER_ID", ""), "Kapow! handler ID")
+	addClientTLSFlags(SetCmd)
 }
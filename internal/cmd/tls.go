@@ -0,0 +1,41 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/BBVA/kapow/internal/http"
+)
+
+// addClientTLSFlags adds the flags needed to reach a Kapow! interface
+// protected with mutual TLS
+func addClientTLSFlags(cmd *cobra.Command) {
+	cmd.Flags().String("client-certfile", getEnv("KAPOW_CLIENT_CERTFILE", ""), "Client certificate to present to the Kapow! server")
+	cmd.Flags().String("client-keyfile", getEnv("KAPOW_CLIENT_KEYFILE", ""), "Key of the client certificate")
+	cmd.Flags().String("cafile", getEnv("KAPOW_CAFILE", ""), "CA bundle used to verify the Kapow! server certificate")
+}
+
+// configureClientTLS sets up the HTTP client with the values of the flags
+// added by addClientTLSFlags
+func configureClientTLS(cmd *cobra.Command) error {
+	cert, _ := cmd.Flags().GetString("client-certfile")
+	key, _ := cmd.Flags().GetString("client-keyfile")
+	ca, _ := cmd.Flags().GetString("cafile")
+
+	return http.ConfigureTLS(cert, key, ca)
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/BBVA/kapow/internal/server/control"
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// Defaults applied to the routes of the configuration file, the same ones
+// used by kapow route add
+const (
+	DefaultMethod     = "GET"
+	DefaultEntrypoint = "/bin/sh -c"
+)
+
+// Config is the content of a kapow server configuration file
+type Config struct {
+	// Path is the file the configuration was read from
+	Path string
+
+	// Settings are the server settings, in file order
+	Settings []Setting
+
+	// Routes are the initial routes of the server, in file order
+	Routes []model.Route
+}
+
+// Setting is a server setting.  Its Name is the one of the matching
+// kapow server flag and its Value is given in the flag syntax.
+type Setting struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// Error is a configuration error located at a line of the file
+type Error struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// routeFields maps the field names of a route, as seen in the control API,
+// to their index in model.Route
+var routeFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(model.Route{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// Load reads and validates the configuration file at path
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, b)
+}
+
+// Parse validates the content of a configuration file.  Every route is
+// checked the same way the control API does, so a file is either loaded
+// as a whole or rejected before the server starts.
+func Parse(path string, b []byte) (*Config, error) {
+	c := &Config{Path: path}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return c, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, c.errorf(root, "expected a mapping with server and routes")
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		var err error
+		switch key.Value {
+		case "server":
+			err = c.parseSettings(value)
+		case "routes":
+			err = c.parseRoutes(value)
+		default:
+			err = c.errorf(key, "unknown section %q", key.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Config) parseSettings(n *yaml.Node) error {
+	if isNull(n) {
+		return nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return c.errorf(n, "server must be a mapping of settings")
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if seen[key.Value] {
+			return c.errorf(key, "duplicated setting %q", key.Value)
+		}
+		seen[key.Value] = true
+		if value.Kind != yaml.ScalarNode {
+			return c.errorf(value, "setting %q must be a single value", key.Value)
+		}
+		s := Setting{Name: key.Value, Line: key.Line}
+		if !isNull(value) {
+			s.Value = value.Value
+		}
+		c.Settings = append(c.Settings, s)
+	}
+
+	return nil
+}
+
+func (c *Config) parseRoutes(n *yaml.Node) error {
+	if isNull(n) {
+		return nil
+	}
+	if n.Kind != yaml.SequenceNode {
+		return c.errorf(n, "routes must be a list")
+	}
+
+	ids := make(map[string]bool)
+	for _, item := range n.Content {
+		r, err := c.parseRoute(item)
+		if err != nil {
+			return err
+		}
+		if r.ID != "" {
+			if ids[r.ID] {
+				return c.errorf(item, "duplicated route id %q", r.ID)
+			}
+			ids[r.ID] = true
+		}
+		if err := control.CheckDuplicate(r, c.Routes); err != nil {
+			return c.errorf(item, "invalid route: %s", err)
+		}
+		c.Routes = append(c.Routes, r)
+	}
+
+	return nil
+}
+
+func (c *Config) parseRoute(n *yaml.Node) (model.Route, error) {
+	r := model.Route{Method: DefaultMethod, Entrypoint: DefaultEntrypoint}
+	if n.Kind != yaml.MappingNode {
+		return r, c.errorf(n, "a route must be a mapping")
+	}
+
+	v := reflect.ValueOf(&r).Elem()
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		field, ok := routeFields[key.Value]
+		if !ok {
+			return r, c.errorf(key, "unknown route field %q", key.Value)
+		}
+		if value.Kind != yaml.ScalarNode {
+			return r, c.errorf(value, "route field %q must be a single value", key.Value)
+		}
+		if err := value.Decode(v.Field(field).Addr().Interface()); err != nil {
+			return r, c.errorf(value, "route field %q: %s", key.Value, err)
+		}
+	}
+
+	// Like in the control API, the index is an output field
+	r.Index = 0
+
+	if err := control.ValidateRoute(r); err != nil {
+		return r, c.errorf(n, "invalid route: %s", err)
+	}
+	if err := control.ValidateID(r.ID); err != nil {
+		return r, c.errorf(n, "invalid route: %s", err)
+	}
+
+	return r, nil
+}
+
+func (c *Config) errorf(n *yaml.Node, format string, a ...interface{}) error {
+	return &Error{Path: c.Path, Line: n.Line, Msg: fmt.Sprintf(format, a...)}
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
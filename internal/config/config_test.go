@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+const sample = `
+server:
+  bind: 0.0.0.0:9090
+  control-bind: unix:/run/kapow/control.sock
+  shutdown-timeout: 5s
+  certfile:
+
+routes:
+  - url_pattern: /hello
+    command: echo Hello | kapow set /response/body
+  - id: greet
+    method: POST
+    url_pattern: /greet/{name}
+    entrypoint: /usr/bin/env python3 -c
+    command: print('hi')
+    pow_file: /etc/kapow/greet.pow
+`
+
+func TestParseReadsSettingsInOrder(t *testing.T) {
+	c, err := Parse("kapow.yaml", []byte(sample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Setting{
+		{Name: "bind", Value: "0.0.0.0:9090", Line: 3},
+		{Name: "control-bind", Value: "unix:/run/kapow/control.sock", Line: 4},
+		{Name: "shutdown-timeout", Value: "5s", Line: 5},
+		{Name: "certfile", Value: "", Line: 6},
+	}
+	if !reflect.DeepEqual(c.Settings, expected) {
+		t.Errorf("Settings mismatch. Expected: %+v. Got: %+v", expected, c.Settings)
+	}
+}
+
+func TestParseReadsRoutesWithDefaults(t *testing.T) {
+	c, err := Parse("kapow.yaml", []byte(sample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []model.Route{
+		{
+			Method:     "GET",
+			Pattern:    "/hello",
+			Entrypoint: "/bin/sh -c",
+			Command:    "echo Hello | kapow set /response/body",
+		},
+		{
+			ID:         "greet",
+			Method:     "POST",
+			Pattern:    "/greet/{name}",
+			Entrypoint: "/usr/bin/env python3 -c",
+			Command:    "print('hi')",
+			PowFile:    "/etc/kapow/greet.pow",
+		},
+	}
+	if !reflect.DeepEqual(c.Routes, expected) {
+		t.Errorf("Routes mismatch. Expected: %+v. Got: %+v", expected, c.Routes)
+	}
+}
+
+func TestParseAcceptsAnEmptyFile(t *testing.T) {
+	c, err := Parse("kapow.yaml", []byte(""))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(c.Settings) != 0 || len(c.Routes) != 0 {
+		t.Errorf("Unexpected content: %+v", c)
+	}
+}
+
+func TestParseIgnoresTheRouteIndex(t *testing.T) {
+	c, err := Parse("kapow.yaml", []byte("routes:\n  - url_pattern: /\n    index: 7\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if c.Routes[0].Index != 0 {
+		t.Errorf("Index mismatch. Expected: 0. Got: %d", c.Routes[0].Index)
+	}
+}
+
+func TestParseReportsTheLineOfEveryError(t *testing.T) {
+	testCases := []struct {
+		name, content, expected string
+	}{
+		{
+			"unknown section",
+			"server: {}\nhandlers: []\n",
+			`kapow.yaml:2: unknown section "handlers"`,
+		},
+		{
+			"server not a mapping",
+			"server:\n  - bind\n",
+			"kapow.yaml:2: server must be a mapping of settings",
+		},
+		{
+			"non scalar setting",
+			"server:\n  bind:\n    - 0.0.0.0:8080\n",
+			`kapow.yaml:3: setting "bind" must be a single value`,
+		},
+		{
+			"duplicated setting",
+			"server:\n  bind: a\n  bind: b\n",
+			`kapow.yaml:3: duplicated setting "bind"`,
+		},
+		{
+			"routes not a list",
+			"routes:\n  url_pattern: /\n",
+			"kapow.yaml:2: routes must be a list",
+		},
+		{
+			"unknown route field",
+			"routes:\n  - url_pattern: /\n    script: ls\n",
+			`kapow.yaml:3: unknown route field "script"`,
+		},
+		{
+			"missing url_pattern",
+			"routes:\n  - url_pattern: /\n  - method: GET\n",
+			"kapow.yaml:3: invalid route: url_pattern is mandatory",
+		},
+		{
+			"empty method",
+			"routes:\n  - method: ''\n    url_pattern: /\n",
+			"kapow.yaml:2: invalid route: method is mandatory",
+		},
+		{
+			"invalid url_pattern",
+			"routes:\n\n  - url_pattern: /he{{o\n",
+			`kapow.yaml:3: invalid route: invalid url_pattern "/he{{o"`,
+		},
+		{
+			"duplicated id",
+			"routes:\n  - {id: a, url_pattern: /}\n  - {id: a, url_pattern: /b}\n",
+			`kapow.yaml:3: duplicated route id "a"`,
+		},
+		{
+			"invalid id",
+			"routes:\n  - {id: 'a b', url_pattern: /}\n",
+			`kapow.yaml:2: invalid route: invalid id "a b"`,
+		},
+		{
+			"duplicated route",
+			"routes:\n  - {url_pattern: /a}\n  - {method: GET, url_pattern: /a}\n",
+			`kapow.yaml:3: invalid route: duplicated route GET /a`,
+		},
+		{
+			"invalid method",
+			"routes:\n  - {method: get, url_pattern: /a}\n",
+			`kapow.yaml:2: invalid route: invalid method "get"`,
+		},
+		{
+			"missing entrypoint executable",
+			"routes:\n  - {url_pattern: /a, entrypoint: /nonexistent/sh -c}\n",
+			`kapow.yaml:2: invalid route: entrypoint executable "/nonexistent/sh" not found`,
+		},
+	}
+
+	for _, tc := range testCases {
+		_, err := Parse("kapow.yaml", []byte(tc.content))
+		if err == nil {
+			t.Errorf("%s: expected error not returned", tc.name)
+		} else if !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: error mismatch. Expected: %q. Got: %q", tc.name, tc.expected, err)
+		}
+	}
+}
+
+func TestParseReportsSyntaxErrorsWithThePath(t *testing.T) {
+	_, err := Parse("kapow.yaml", []byte("server: [\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "kapow.yaml: ") {
+		t.Errorf("Error mismatch. Got: %v", err)
+	}
+}
+
+func TestLoadFailsWhenTheFileDoesntExist(t *testing.T) {
+	if _, err := Load("/nonexistent/kapow.yaml"); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
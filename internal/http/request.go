@@ -17,10 +17,17 @@
 package http
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+
+	"github.com/BBVA/kapow/internal/server/certs"
 )
 
 // Get perform a request using Request with the GET method
@@ -38,6 +45,11 @@ func Put(url string, contentType string, r io.Reader, w io.Writer) error {
 	return Request("PUT", url, contentType, r, w)
 }
 
+// Patch perform a request using Request with the PATCH method
+func Patch(url string, contentType string, r io.Reader, w io.Writer) error {
+	return Request("PATCH", url, contentType, r, w)
+}
+
 // Delete perform a request using Request with the DELETE method
 func Delete(url string, contentType string, r io.Reader, w io.Writer) error {
 	return Request("DELETE", url, contentType, r, w)
@@ -45,11 +57,56 @@ func Delete(url string, contentType string, r io.Reader, w io.Writer) error {
 
 var devnull = ioutil.Discard
 
+// warnings is where the warnings sent by the server are written to
+var warnings io.Writer = os.Stderr
+
+var client = new(http.Client)
+
+// ConfigureTLS makes Request present the client certificate in certFile and
+// keyFile and trust the CAs in caFile when talking to https URLs.  Every
+// argument is optional.
+func ConfigureTLS(certFile, keyFile, caFile string) error {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil
+	}
+
+	tlsConfig, err := certs.ClientTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		return err
+	}
+	client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return nil
+}
+
+var bearerToken string
+
+// SetBearerToken makes Request send token in the Authorization header of
+// every request.  An empty token sends no header.
+func SetBearerToken(token string) {
+	bearerToken = token
+}
+
 // Request will perform the request to the given url and method sending the
 // content of the given reader as the body and writing all the contents
 // of the response to the given writer. The reader and writer are
 // optional.
+//
+// Besides http and https URLs it accepts "unix:" URLs, made of the path of a
+// unix domain socket followed by the path of the resource, e.g.
+// "unix:/run/kapow/control.sock/routes".
 func Request(method string, url string, contentType string, r io.Reader, w io.Writer) error {
+	c := client
+	if strings.HasPrefix(url, unixPrefix) {
+		socket, path, err := splitUnixURL(url)
+		if err != nil {
+			return err
+		}
+		url = "http://unix" + path
+		c = unixClient(socket)
+	}
+
 	req, err := http.NewRequest(method, url, r)
 	if err != nil {
 		return err
@@ -58,8 +115,11 @@ func Request(method string, url string, contentType string, r io.Reader, w io.Wr
 	if contentType != "" {
 		req.Header.Add("Content-Type", contentType)
 	}
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
 
-	res, err := new(http.Client).Do(req)
+	res, err := c.Do(req)
 	if err != nil {
 		return err
 	}
@@ -73,6 +133,10 @@ func Request(method string, url string, contentType string, r io.Reader, w io.Wr
 		return errors.New(reason)
 	}
 
+	for _, warning := range res.Header["Warning"] {
+		fmt.Fprintf(warnings, "Warning: %s\n", warning)
+	}
+
 	if w == nil {
 		_, err = io.Copy(devnull, res.Body)
 	} else {
@@ -81,3 +145,38 @@ func Request(method string, url string, contentType string, r io.Reader, w io.Wr
 
 	return err
 }
+
+const unixPrefix = "unix:"
+
+// splitUnixURL splits a "unix:" URL in the path of the socket, that is,
+// the shortest prefix of the URL path that is a socket file, and the path
+// of the resource
+func splitUnixURL(url string) (socket, path string, err error) {
+	p := strings.TrimPrefix(url, unixPrefix)
+	for i := 1; i <= len(p); i++ {
+		if i < len(p) && p[i] != '/' {
+			continue
+		}
+		if fi, err := os.Stat(p[:i]); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			path = p[i:]
+			if path == "" {
+				path = "/"
+			}
+			return p[:i], path, nil
+		}
+	}
+	return "", "", fmt.Errorf("no unix socket found in %q", url)
+}
+
+// unixClient returns an http.Client that sends every request through the
+// unix domain socket in socket
+func unixClient(socket string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
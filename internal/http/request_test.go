@@ -19,7 +19,11 @@ package http
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
 	gock "gopkg.in/h2non/gock.v1"
@@ -152,6 +156,58 @@ func TestSendContentType(t *testing.T) {
 	}
 }
 
+func TestSendBearerToken(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		MatchHeader("Authorization", "^Bearer FOO$").
+		Reply(http.StatusOK)
+	SetBearerToken("FOO")
+	defer SetBearerToken("")
+
+	err := Request("GET", "http://localhost", "", nil, nil)
+	if err != nil {
+		t.Errorf("Unexpected error '%v'", err.Error())
+	}
+
+	if !gock.IsDone() {
+		t.Error("No expected endpoint called")
+	}
+}
+
+func TestDontSendAuthorizationWithoutBearerToken(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		HeaderPresent("Authorization").
+		Reply(http.StatusTeapot)
+	gock.New("http://localhost").
+		Reply(http.StatusOK)
+
+	err := Request("GET", "http://localhost", "", nil, nil)
+	if err != nil {
+		t.Errorf("Unexpected error '%v'", err.Error())
+	}
+}
+
+func TestWriteTheWarningsOfTheResponse(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Post("/").
+		Reply(http.StatusCreated).
+		AddHeader("Warning", `199 kapow "route shadowed"`)
+	origWarnings := warnings
+	defer func() { warnings = origWarnings }()
+	buf := &bytes.Buffer{}
+	warnings = buf
+
+	if err := Post("http://localhost/", "", nil, nil); err != nil {
+		t.Errorf("Unexpected error %q", err)
+	}
+
+	if buf.String() != "Warning: 199 kapow \"route shadowed\"\n" {
+		t.Errorf("Unexpected warnings: %q", buf.String())
+	}
+}
+
 func TestGetRequestsWithMethodGet(t *testing.T) {
 	defer gock.Off()
 	gock.New("http://localhost").
@@ -203,6 +259,23 @@ func TestPutRequestsWithMethodPut(t *testing.T) {
 	}
 }
 
+func TestPatchRequestsWithMethodPatch(t *testing.T) {
+	defer gock.Off()
+	gock.New("http://localhost").
+		Patch("/").
+		Reply(http.StatusOK)
+
+	err := Patch("http://localhost/", "", nil, nil)
+
+	if err != nil {
+		t.Errorf("Unexpected error %q", err)
+	}
+
+	if !gock.IsDone() {
+		t.Error("No expected endpoint called")
+	}
+}
+
 func TestDeleteRequestsWithMethodDelete(t *testing.T) {
 	defer gock.Off()
 	gock.New("http://localhost").
@@ -219,3 +292,59 @@ func TestDeleteRequestsWithMethodDelete(t *testing.T) {
 		t.Error("No expected endpoint called")
 	}
 }
+
+func TestConfigureTLSKeepsTheClientWhenNothingIsGiven(t *testing.T) {
+	original := client
+
+	err := ConfigureTLS("", "", "")
+
+	if err != nil {
+		t.Errorf("Unexpected error %q", err)
+	}
+
+	if client != original {
+		t.Error("Client was replaced")
+	}
+}
+
+func TestConfigureTLSReturnsErrorOnMissingFiles(t *testing.T) {
+	original := client
+	defer func() { client = original }()
+
+	err := ConfigureTLS("/nonexistent/cert.pem", "/nonexistent/key.pem", "")
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestRequestThroughUnixSocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-http")
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "control.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	})}
+	go func() { _ = s.Serve(l) }()
+	defer s.Close()
+	rw := new(bytes.Buffer)
+
+	err = Get("unix:"+socket+"/routes/FOO", "", nil, rw)
+
+	if err != nil {
+		t.Errorf("Unexpected error %q", err)
+	}
+	if rw.String() != "/routes/FOO" {
+		t.Errorf(`Path mismatch. Expected: "/routes/FOO". Got: %q`, rw.String())
+	}
+}
+
+func TestSplitUnixURLReturnsErrorWhenThereIsNoSocket(t *testing.T) {
+	if _, _, err := splitUnixURL("unix:/nonexistent/control.sock/routes"); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
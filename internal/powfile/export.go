@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package powfile
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// Export writes a pow file that adds the given routes, in the same order and
+// with the same ids, when run
+func Export(w io.Writer, routes []model.Route) error {
+	if _, err := fmt.Fprintln(w, "#!/bin/sh"); err != nil {
+		return err
+	}
+	for _, r := range routes {
+		id := ""
+		if r.ID != "" {
+			id = "--id " + Quote(r.ID) + " "
+		}
+		_, err := fmt.Fprintf(w, "kapow route add %s-X %s -e %s -c %s %s\n",
+			id, Quote(r.Method), Quote(r.Entrypoint), Quote(r.Command), Quote(r.Pattern))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quote returns s as a single shell word, enclosed in single quotes
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package powfile
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestQuoteEnclosesInSingleQuotes(t *testing.T) {
+	testCases := map[string]string{
+		"":                    `''`,
+		"echo Hello":          `'echo Hello'`,
+		"echo 'Hello'":        `'echo '\''Hello'\'''`,
+		`echo "$HOME" \ $(x)`: `'echo "$HOME" \ $(x)'`,
+	}
+
+	for s, expected := range testCases {
+		if q := Quote(s); q != expected {
+			t.Errorf("Quote mismatch for %q. Expected: %s. Got: %s", s, expected, q)
+		}
+	}
+}
+
+func TestQuoteIsUndoneByTheShell(t *testing.T) {
+	s := "it's \"$HOME\"\n\t`ls` \\ $(id) ; *"
+
+	out, err := exec.Command("/bin/sh", "-c", "printf %s "+Quote(s)).Output()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != s {
+		t.Errorf("Shell word mismatch. Expected: %q. Got: %q", s, out)
+	}
+}
+
+func TestExportWritesAKapowRouteAddLinePerRoute(t *testing.T) {
+	routes := []model.Route{
+		{Method: "GET", Pattern: "/hello", Entrypoint: "/bin/sh -c", Command: "echo 'Hello' | kapow set /response/body"},
+		{Method: "POST", Pattern: "/{x}", Entrypoint: "", Command: ""},
+	}
+	buf := &bytes.Buffer{}
+
+	if err := Export(buf, routes); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `#!/bin/sh
+kapow route add -X 'GET' -e '/bin/sh -c' -c 'echo '\''Hello'\'' | kapow set /response/body' '/hello'
+kapow route add -X 'POST' -e '' -c '' '/{x}'
+`
+	if buf.String() != expected {
+		t.Errorf("Pow file mismatch. Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestExportKeepsTheRouteIDs(t *testing.T) {
+	routes := []model.Route{{ID: "hello", Method: "GET", Pattern: "/hello", Entrypoint: "/bin/sh -c", Command: "true"}}
+	buf := &bytes.Buffer{}
+
+	if err := Export(buf, routes); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `#!/bin/sh
+kapow route add --id 'hello' -X 'GET' -e '/bin/sh -c' -c 'true' '/hello'
+`
+	if buf.String() != expected {
+		t.Errorf("Pow file mismatch. Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package powfile
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/shlex"
+)
+
+// DefaultShell is the interpreter used for pow files without a shebang line
+// when no other shell is requested
+const DefaultShell = "bash"
+
+// Interpreter returns the command line that must be used to run the pow
+// file in path.
+//
+// When shell is not empty it is split according to the shell parsing rules
+// and used as is.  Otherwise the interpreter declared in the shebang line
+// of the file is used, falling back to DefaultShell.
+func Interpreter(path, shell string) ([]string, error) {
+	if shell != "" {
+		args, err := shlex.Split(shell)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, errors.New("Pow shell cannot be empty")
+		}
+		return args, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return []string{DefaultShell}, nil
+	}
+
+	args := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Empty shebang line in %q", path)
+	}
+	return args, nil
+}
+
+// Run runs the pow file in path with the interpreter chosen by Interpreter.
+// The process inherits the standard output and error and gets the current
+// environment plus env and KAPOW_POW_FILE, so the routes it adds are
+// owned by the pow file.  The process is started in a process group of its
+// own, which is killed if ctx is done before it finishes.
+func Run(ctx context.Context, path, shell string, env []string) error {
+	args, err := Interpreter(path, shell)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(append(os.Environ(), env...), "KAPOW_POW_FILE="+path)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = killProcessGroup(cmd.Process)
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// RunAll calls run with every pow file in paths, in order, stopping at the
+// first one that fails.  The returned error names the pow file that failed.
+func RunAll(paths []string, run func(path string) error) error {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("pow file %q: %s", path, err)
+		}
+	}
+
+	for _, path := range paths {
+		if err := run(path); err != nil {
+			return fmt.Errorf("pow file %q: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// Watch checks the pow files in paths every interval and calls onChange
+// with the path of the ones whose size or modification time changed.  Pow
+// files that can't be read are skipped until they are back.  It returns
+// when stop is closed.
+func Watch(paths []string, interval time.Duration, stop <-chan struct{}, onChange func(path string)) {
+	seen := make(map[string]os.FileInfo)
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			seen[path] = fi
+		}
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if prev, ok := seen[path]; ok && prev.ModTime().Equal(fi.ModTime()) && prev.Size() == fi.Size() {
+				continue
+			}
+			seen[path] = fi
+			onChange(path)
+		}
+	}
+}
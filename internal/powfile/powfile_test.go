@@ -0,0 +1,212 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package powfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePowFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInterpreterUsesTheGivenShell(t *testing.T) {
+	args, err := Interpreter("/nonexistent", "python3 -u")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"python3", "-u"}) {
+		t.Errorf("Interpreter mismatch. Got: %q", args)
+	}
+}
+
+func TestInterpreterReadsTheShebangLine(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	path := writePowFile(t, dir, "foo.pow", "#!/usr/bin/env python3\nprint('hi')\n")
+
+	args, err := Interpreter(path, "")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"/usr/bin/env", "python3"}) {
+		t.Errorf("Interpreter mismatch. Got: %q", args)
+	}
+}
+
+func TestInterpreterDefaultsToBash(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	path := writePowFile(t, dir, "foo.pow", "kapow route add / -c 'echo hi'\n")
+
+	args, err := Interpreter(path, "")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{DefaultShell}) {
+		t.Errorf("Interpreter mismatch. Got: %q", args)
+	}
+}
+
+func TestInterpreterFailsOnEmptyShebang(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	path := writePowFile(t, dir, "foo.pow", "#!\n")
+
+	if _, err := Interpreter(path, ""); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestRunPassesTheEnvironment(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	path := writePowFile(t, dir, "foo.pow", "#!/bin/sh\necho $FOO > "+out+"\n")
+
+	if err := Run(context.Background(), path, "", []string{"FOO=BAR"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if b, _ := ioutil.ReadFile(out); string(b) != "BAR\n" {
+		t.Errorf(`Output mismatch. Expected: "BAR\n". Got: %q`, string(b))
+	}
+}
+
+func TestRunKillsThePowFileWhenTheContextIsDone(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	path := writePowFile(t, dir, "foo.pow", "sleep 10\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Run(ctx, path, "/bin/sh", nil)
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Pow file not killed, ran for %s", d)
+	}
+}
+
+func TestRunSetsThePowFileInTheEnvironment(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	path := writePowFile(t, dir, "foo.pow", "echo $KAPOW_POW_FILE > "+out+"\n")
+
+	if err := Run(context.Background(), path, "/bin/sh", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if b, _ := ioutil.ReadFile(out); string(b) != path+"\n" {
+		t.Errorf("Output mismatch. Expected: %q. Got: %q", path+"\n", string(b))
+	}
+}
+
+func TestRunAllRunsEveryPowFileInOrder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	first := writePowFile(t, dir, "first.pow", "echo first >> "+out+"\n")
+	second := writePowFile(t, dir, "second.pow", "echo second >> "+out+"\n")
+
+	if err := RunAll([]string{first, second}, func(path string) error { return Run(context.Background(), path, "/bin/sh", nil) }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if b, _ := ioutil.ReadFile(out); string(b) != "first\nsecond\n" {
+		t.Errorf("Pow files not run in order. Got: %q", string(b))
+	}
+}
+
+func TestRunAllStopsAtTheFirstFailureAndNamesTheFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	first := writePowFile(t, dir, "first.pow", "exit 3\n")
+	second := writePowFile(t, dir, "second.pow", "echo second >> "+out+"\n")
+
+	err := RunAll([]string{first, second}, func(path string) error { return Run(context.Background(), path, "/bin/sh", nil) })
+
+	if err == nil || !strings.Contains(err.Error(), "first.pow") {
+		t.Errorf("Error doesn't name the failing pow file: %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Pow files run after a failure")
+	}
+}
+
+func TestRunAllChecksEveryFileExistsBeforeRunning(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	first := writePowFile(t, dir, "first.pow", "echo first >> "+out+"\n")
+
+	err := RunAll([]string{first, filepath.Join(dir, "missing.pow")}, func(path string) error { return Run(context.Background(), path, "/bin/sh", nil) })
+
+	if err == nil || !strings.Contains(err.Error(), "missing.pow") {
+		t.Errorf("Error doesn't name the missing pow file: %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Pow files run before checking all of them")
+	}
+}
+
+func TestWatchCallsOnChangeWhenAPowFileIsModified(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-powfile")
+	defer os.RemoveAll(dir)
+	foo := writePowFile(t, dir, "foo.pow", "echo foo\n")
+	bar := writePowFile(t, dir, "bar.pow", "echo bar\n")
+	stop := make(chan struct{})
+	changed := make(chan string, 2)
+	go Watch([]string{foo, bar}, 5*time.Millisecond, stop, func(path string) { changed <- path })
+	defer close(stop)
+
+	time.Sleep(20 * time.Millisecond)
+	writePowFile(t, dir, "bar.pow", "echo bar changed\n")
+
+	select {
+	case path := <-changed:
+		if path != bar {
+			t.Errorf("Changed pow file mismatch. Expected: %q. Got: %q", bar, path)
+		}
+	case <-time.After(time.Second):
+		t.Error("Change not detected")
+	}
+	select {
+	case path := <-changed:
+		t.Errorf("Unexpected change reported for %q", path)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package powfile
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing, as there are no process groups to kill
+// on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills p.  Its children are left running.
+func killProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accesslog writes a line for every request served by the user
+// interface.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Format is the layout of the access log lines
+type Format string
+
+const (
+	// Common is the Common Log Format followed by the Kapow! fields
+	Common Format = "common"
+	// Combined is the Combined Log Format followed by the Kapow! fields
+	Combined Format = "combined"
+	// JSON writes every entry as a JSON object in its own line
+	JSON Format = "json"
+)
+
+// ParseFormat returns the Format named s
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case Common, Combined, JSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown access log format %q, expected common, combined or json", s)
+}
+
+// Stdout is the path that makes a Logger write to the standard output
+const Stdout = "-"
+
+// Entry holds the details of a served request
+type Entry struct {
+	Time       time.Time
+	RemoteAddr string
+	HandlerID  string
+	RouteID    string
+	Pattern    string
+	Method     string
+	Path       string
+	Proto      string
+	Referer    string
+	UserAgent  string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration
+
+	// ExitCode is the exit code of the spawned process, nil if it
+	// couldn't be run
+	ExitCode *int
+}
+
+// Logger writes access log entries to a file or the standard output
+type Logger struct {
+	path   string
+	format Format
+
+	m sync.Mutex
+	w io.Writer
+	f *os.File
+}
+
+// New returns a Logger writing entries in the given format to the file at
+// path, which is created if needed, or to the standard output when path is
+// Stdout
+func New(path string, format Format) (*Logger, error) {
+	if _, err := ParseFormat(string(format)); err != nil {
+		return nil, err
+	}
+	l := &Logger{path: path, format: format, w: os.Stdout}
+	if err := l.Reopen(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reopen opens the log file again, so the server starts writing to a new
+// one after it has been rotated.  The current file is kept when the new
+// one can't be opened.
+func (l *Logger) Reopen() error {
+	if l.path == Stdout {
+		return nil
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	l.m.Lock()
+	old := l.f
+	l.f, l.w = f, f
+	l.m.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// ReopenOn reopens the log file every time one of the given signals is
+// received.  Errors are logged and the current file stays in use.
+func (l *Logger) ReopenOn(sig ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		for range c {
+			if err := l.Reopen(); err != nil {
+				log.Printf("Access log reopen failed, keeping the current file: %s", err)
+			}
+		}
+	}()
+}
+
+// Log writes e to the log.  Nothing is written by a nil Logger.
+func (l *Logger) Log(e Entry) {
+	if l == nil {
+		return
+	}
+	line := l.formatEntry(e)
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		log.Printf("Access log write failed: %s", err)
+	}
+}
+
+func (l *Logger) formatEntry(e Entry) []byte {
+	switch l.format {
+	case JSON:
+		return formatJSON(e)
+	case Combined:
+		return formatCLF(e, true)
+	default:
+		return formatCLF(e, false)
+	}
+}
+
+// clfTime is the time layout of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+func formatCLF(e Entry, combined bool) []byte {
+	b := make([]byte, 0, 256)
+	b = append(b, orDash(remoteHost(e.RemoteAddr))...)
+	b = append(b, " - - ["...)
+	b = append(b, e.Time.Format(clfTime)...)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, e.Method+" "+e.Path+" "+e.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	if e.Bytes > 0 {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	} else {
+		b = append(b, '-')
+	}
+	if combined {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.Referer))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.UserAgent))
+	}
+	b = append(b, ' ')
+	b = append(b, orDash(e.HandlerID)...)
+	b = append(b, ' ')
+	b = append(b, orDash(e.RouteID)...)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, e.Pattern)
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, e.Duration.Seconds(), 'f', 6, 64)
+	b = append(b, ' ')
+	if e.ExitCode != nil {
+		b = strconv.AppendInt(b, int64(*e.ExitCode), 10)
+	} else {
+		b = append(b, '-')
+	}
+	return append(b, '\n')
+}
+
+// jsonEntry is the layout of the entries in the JSON format
+type jsonEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remote_addr"`
+	HandlerID  string  `json:"handler_id"`
+	RouteID    string  `json:"route_id"`
+	Pattern    string  `json:"pattern"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Proto      string  `json:"proto"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	Duration   float64 `json:"duration"`
+	ExitCode   *int    `json:"exit_code"`
+}
+
+func formatJSON(e Entry) []byte {
+	b, _ := json.Marshal(jsonEntry{
+		Time:       e.Time.Format(time.RFC3339Nano),
+		RemoteAddr: e.RemoteAddr,
+		HandlerID:  e.HandlerID,
+		RouteID:    e.RouteID,
+		Pattern:    e.Pattern,
+		Method:     e.Method,
+		Path:       e.Path,
+		Proto:      e.Proto,
+		Referer:    e.Referer,
+		UserAgent:  e.UserAgent,
+		Status:     e.Status,
+		Bytes:      e.Bytes,
+		Duration:   e.Duration.Seconds(),
+		ExitCode:   e.ExitCode,
+	})
+	return append(b, '\n')
+}
+
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func sampleEntry() Entry {
+	code := 3
+	return Entry{
+		Time:       time.Date(2019, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		RemoteAddr: "127.0.0.1:54321",
+		HandlerID:  "HANDLER",
+		RouteID:    "ROUTE",
+		Pattern:    "/hello/{name}",
+		Method:     "GET",
+		Path:       "/hello/world?x=1",
+		Proto:      "HTTP/1.1",
+		Referer:    "http://example.com/",
+		UserAgent:  `curl "7"`,
+		Status:     200,
+		Bytes:      11,
+		Duration:   1500 * time.Microsecond,
+		ExitCode:   &code,
+	}
+}
+
+func TestParseFormatAcceptsTheKnownFormats(t *testing.T) {
+	for _, s := range []string{"common", "combined", "json"} {
+		if f, err := ParseFormat(s); err != nil || string(f) != s {
+			t.Errorf("Format mismatch. Expected: %q. Got: %q, %v", s, f, err)
+		}
+	}
+}
+
+func TestParseFormatRejectsUnknownFormats(t *testing.T) {
+	if _, err := ParseFormat("apache"); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestFormatCommon(t *testing.T) {
+	l := &Logger{format: Common}
+
+	expected := `127.0.0.1 - - [10/Oct/2019:13:55:36 -0700] "GET /hello/world?x=1 HTTP/1.1" 200 11 HANDLER ROUTE "/hello/{name}" 0.001500 3` + "\n"
+	if got := string(l.formatEntry(sampleEntry())); got != expected {
+		t.Errorf("Line mismatch.\nExpected: %q\nGot:      %q", expected, got)
+	}
+}
+
+func TestFormatCombined(t *testing.T) {
+	l := &Logger{format: Combined}
+
+	expected := `127.0.0.1 - - [10/Oct/2019:13:55:36 -0700] "GET /hello/world?x=1 HTTP/1.1" 200 11 "http://example.com/" "curl \"7\"" HANDLER ROUTE "/hello/{name}" 0.001500 3` + "\n"
+	if got := string(l.formatEntry(sampleEntry())); got != expected {
+		t.Errorf("Line mismatch.\nExpected: %q\nGot:      %q", expected, got)
+	}
+}
+
+func TestFormatCommonUsesDashesForMissingValues(t *testing.T) {
+	l := &Logger{format: Common}
+	e := sampleEntry()
+	e.HandlerID, e.Bytes, e.ExitCode = "", 0, nil
+
+	expected := `127.0.0.1 - - [10/Oct/2019:13:55:36 -0700] "GET /hello/world?x=1 HTTP/1.1" 200 - - ROUTE "/hello/{name}" 0.001500 -` + "\n"
+	if got := string(l.formatEntry(e)); got != expected {
+		t.Errorf("Line mismatch.\nExpected: %q\nGot:      %q", expected, got)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	l := &Logger{format: JSON}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(l.formatEntry(sampleEntry()), &got); err != nil {
+		t.Fatalf("Invalid JSON line: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"time":        "2019-10-10T13:55:36-07:00",
+		"remote_addr": "127.0.0.1:54321",
+		"handler_id":  "HANDLER",
+		"route_id":    "ROUTE",
+		"pattern":     "/hello/{name}",
+		"method":      "GET",
+		"path":        "/hello/world?x=1",
+		"proto":       "HTTP/1.1",
+		"referer":     "http://example.com/",
+		"user_agent":  `curl "7"`,
+		"status":      float64(200),
+		"bytes":       float64(11),
+		"duration":    0.0015,
+		"exit_code":   float64(3),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Entry mismatch.\nExpected: %v\nGot:      %v", expected, got)
+	}
+}
+
+func TestLogOnANilLoggerDoesNothing(t *testing.T) {
+	var l *Logger
+
+	l.Log(sampleEntry())
+}
+
+func TestNewRejectsUnknownFormats(t *testing.T) {
+	if _, err := New(Stdout, Format("apache")); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestLogAppendsToTheFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-accesslog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+	_ = ioutil.WriteFile(path, []byte("previous\n"), 0644)
+
+	l, err := New(path, JSON)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l.Log(sampleEntry())
+
+	b, _ := ioutil.ReadFile(path)
+	if expected := "previous\n" + string(l.formatEntry(sampleEntry())); string(b) != expected {
+		t.Errorf("Content mismatch. Expected: %q. Got: %q", expected, b)
+	}
+}
+
+func TestReopenWritesToANewFileAfterRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-accesslog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+	l, _ := New(path, Common)
+	l.Log(sampleEntry())
+	_ = os.Rename(path, path+".1")
+
+	if err := l.Reopen(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l.Log(sampleEntry())
+
+	line := string(l.formatEntry(sampleEntry()))
+	if b, _ := ioutil.ReadFile(path + ".1"); string(b) != line {
+		t.Errorf("Rotated content mismatch. Expected: %q. Got: %q", line, b)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != line {
+		t.Errorf("New content mismatch. Expected: %q. Got: %q", line, b)
+	}
+}
+
+func TestReopenKeepsTheCurrentFileOnError(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-accesslog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+	l, _ := New(path, Common)
+	_ = os.Rename(path, path+".1")
+	_ = os.Mkdir(path, 0755)
+
+	if err := l.Reopen(); err == nil {
+		t.Error("Expected error not returned")
+	}
+	l.Log(sampleEntry())
+
+	if b, _ := ioutil.ReadFile(path + ".1"); len(b) == 0 {
+		t.Error("Entry not written to the current file")
+	}
+}
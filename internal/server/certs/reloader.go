@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certs
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// Reloader holds a TLS certificate loaded from a pair of PEM files and
+// allows replacing it with a fresh copy from disk while the server keeps
+// running.
+type Reloader struct {
+	certFile, keyFile string
+
+	m    sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewReloader loads the given certificate and key pair and returns a
+// Reloader serving it
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate and key files again.  The current
+// certificate is kept when the new pair cannot be loaded.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	r.cert = &cert
+	r.m.Unlock()
+
+	return nil
+}
+
+// GetCertificate returns the current certificate.  It is meant to be used
+// as the GetCertificate callback of a tls.Config, so every new TLS
+// handshake picks the last loaded certificate and established connections
+// are left untouched.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.cert, nil
+}
+
+// ReloadOn reloads the certificate every time one of the given signals is
+// received.  Errors are logged and the previous certificate stays in use.
+func (r *Reloader) ReloadOn(sig ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		for range c {
+			if err := r.Reload(); err != nil {
+				log.Printf("Certificate reload failed, keeping the current one: %s", err)
+			} else {
+				log.Printf("Certificate reloaded from %q", r.certFile)
+			}
+		}
+	}()
+}
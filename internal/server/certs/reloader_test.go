@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned creates a self-signed certificate for commonName and
+// stores it, along with its key, as PEM files inside dir
+func writeSelfSigned(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	c, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestNewReloaderFailsWhenFilesDontExist(t *testing.T) {
+	if _, err := NewReloader("/nonexistent/cert.pem", "/nonexistent/key.pem"); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestNewReloaderLoadsTheCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	cert, key := writeSelfSigned(t, dir, "FOO")
+
+	r, err := NewReloader(cert, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cn := commonName(t, r); cn != "FOO" {
+		t.Errorf(`Certificate mismatch. Expected: "FOO". Got: %q`, cn)
+	}
+}
+
+func TestReloadReplacesTheCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	cert, key := writeSelfSigned(t, dir, "FOO")
+	r, _ := NewReloader(cert, key)
+	writeSelfSigned(t, dir, "BAR")
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cn := commonName(t, r); cn != "BAR" {
+		t.Errorf(`Certificate mismatch. Expected: "BAR". Got: %q`, cn)
+	}
+}
+
+func TestReloadKeepsTheCertificateWhenNewOneIsInvalid(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	cert, key := writeSelfSigned(t, dir, "FOO")
+	r, _ := NewReloader(cert, key)
+	_ = ioutil.WriteFile(cert, []byte("garbage"), 0600)
+
+	if err := r.Reload(); err == nil {
+		t.Error("Expected error not returned")
+	}
+
+	if cn := commonName(t, r); cn != "FOO" {
+		t.Errorf(`Certificate mismatch. Expected: "FOO". Got: %q`, cn)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"syscall"
+)
+
+// TLSConfig builds a server side tls.Config that serves the certificate in
+// certFile and keyFile, reloading it on SIGHUP
+func TLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cr, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cr.ReloadOn(syscall.SIGHUP)
+
+	return &tls.Config{GetCertificate: cr.GetCertificate}, nil
+}
+
+// MutualTLSConfig builds a server side tls.Config that serves the
+// certificate in certFile and keyFile and requires every client to present
+// a certificate signed by one of the CAs in caFile.
+//
+// The server certificate is reloaded on SIGHUP.
+func MutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cr, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCAPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	cr.ReloadOn(syscall.SIGHUP)
+
+	return &tls.Config{
+		GetCertificate: cr.GetCertificate,
+		ClientCAs:      pool,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// ClientTLSConfig builds a client side tls.Config that presents the
+// certificate in certFile and keyFile and trusts the CAs in caFile.  Both
+// parts are optional: an empty certFile means no client certificate and
+// an empty caFile means using the system CAs.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	conf := &tls.Config{}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("expected both or neither client certificate and key")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pool, err := loadCAPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = pool
+	}
+
+	return conf, nil
+}
+
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no valid certificates found in %q", caFile)
+	}
+	return pool, nil
+}
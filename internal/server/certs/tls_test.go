@@ -0,0 +1,118 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certs
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mutualTLSServer(t *testing.T, dir string) (url string, closer func(), caFile string) {
+	serverDir := filepath.Join(dir, "server")
+	_ = os.Mkdir(serverDir, 0700)
+	cert, key := writeSelfSigned(t, serverDir, "server")
+	conf, err := MutualTLSConfig(cert, key, cert)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := &http.Server{
+		Handler:  http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go func() { _ = s.Serve(tls.NewListener(l, conf)) }()
+	return "https://" + l.Addr().String(), func() { s.Close() }, cert
+}
+
+func TestMutualTLSConfigFailsWhenCAFileIsInvalid(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	cert, key := writeSelfSigned(t, dir, "FOO")
+
+	if _, err := MutualTLSConfig(cert, key, key); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestClientTLSConfigFailsWhenOnlyCertIsGiven(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	cert, _ := writeSelfSigned(t, dir, "FOO")
+
+	if _, err := ClientTLSConfig(cert, "", ""); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestMutualTLSAcceptsTrustedClientCertificates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	url, closer, ca := mutualTLSServer(t, dir)
+	defer closer()
+	// The server certificate is self-signed, so it can act as a client
+	// certificate signed by the server CA
+	conf, err := ClientTLSConfig(ca, filepath.Join(dir, "server", "key.pem"), ca)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+
+	res, err := c.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestMutualTLSRejectsClientsWithoutCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	url, closer, ca := mutualTLSServer(t, dir)
+	defer closer()
+	conf, _ := ClientTLSConfig("", "", ca)
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+
+	if res, err := c.Get(url); err == nil {
+		res.Body.Close()
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestMutualTLSRejectsUntrustedClientCertificates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-certs")
+	defer os.RemoveAll(dir)
+	url, closer, ca := mutualTLSServer(t, dir)
+	defer closer()
+	cert, key := writeSelfSigned(t, dir, "intruder")
+	conf, _ := ClientTLSConfig(cert, key, ca)
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+
+	if res, err := c.Get(url); err == nil {
+		res.Body.Close()
+		t.Error("Expected error not returned")
+	}
+}
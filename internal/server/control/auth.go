@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/BBVA/kapow/internal/server/httperror"
+)
+
+// Role is the set of control API operations allowed to a token
+type Role int
+
+const (
+	// RoleReadOnly allows listing and getting routes
+	RoleReadOnly Role = iota + 1
+	// RoleAdmin allows every operation
+	RoleAdmin
+)
+
+// roleNames are the names of the roles in the tokens file
+var roleNames = map[string]Role{
+	"read-only": RoleReadOnly,
+	"admin":     RoleAdmin,
+}
+
+// Token is a bearer token accepted by the control API
+type Token struct {
+	Value string
+	Role  Role
+	// Name identifies the holder of the token in the route history.  It is
+	// optional.
+	Name string
+}
+
+// identity returns how the changes made with t are recorded in the route
+// history: its name, or a fingerprint of its value if it has none
+func (t Token) identity() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	sum := sha256.Sum256([]byte(t.Value))
+	return "token " + hex.EncodeToString(sum[:4])
+}
+
+// LoadTokens reads the tokens file at path.  Every line holds a token, its
+// role, read-only or admin, and optionally a name, separated by blanks.
+// Empty lines and lines starting with # are ignored.
+func LoadTokens(path string) ([]Token, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ts []Token
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected a token, its role and optionally a name", path, n)
+		}
+		role, ok := roleNames[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown role %q, expected read-only or admin", path, n, fields[1])
+		}
+		t := Token{Value: fields[0], Role: role}
+		if len(fields) == 3 {
+			t.Name = fields[2]
+		}
+		ts = append(ts, t)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(ts) == 0 {
+		return nil, fmt.Errorf("%s: no tokens found", path)
+	}
+
+	return ts, nil
+}
+
+// NewToken returns a random token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var (
+	tokensLock sync.RWMutex
+	tokens     []Token
+)
+
+// SetTokens makes the control API require one of the given tokens.  With no
+// tokens every request is allowed.
+func SetTokens(ts []Token) {
+	tokensLock.Lock()
+	tokens = ts
+	tokensLock.Unlock()
+}
+
+// findToken returns the token with the given value and false if it isn't
+// accepted.  Every token is compared in constant time.
+func findToken(value string) (Token, bool) {
+	tokensLock.RLock()
+	defer tokensLock.RUnlock()
+
+	var found Token
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Value), []byte(value)) == 1 {
+			found = t
+		}
+	}
+	return found, found.Role != 0
+}
+
+func authEnabled() bool {
+	tokensLock.RLock()
+	defer tokensLock.RUnlock()
+	return len(tokens) > 0
+}
+
+// requiredRole returns the role needed to make the request r, or zero if
+// it doesn't need a token.  Matching a request against the routes changes
+// nothing, so it is allowed to read-only tokens.  The handlers in flight
+// are only shown to admin tokens, as their ids give access to their
+// requests thru the data interface.
+func requiredRole(r *http.Request) Role {
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+		return 0
+	case r.URL.Path == "/handlers" || strings.HasPrefix(r.URL.Path, "/handlers/"):
+		return RoleAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return RoleReadOnly
+	case r.Method == http.MethodPost && r.URL.Path == "/routes:match":
+		return RoleReadOnly
+	default:
+		return RoleAdmin
+	}
+}
+
+// authenticate decorates h so every request must carry a bearer token with
+// the role needed, when tokens are configured
+func authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		needed := requiredRole(req)
+		if needed == 0 || !authEnabled() {
+			h.ServeHTTP(res, req)
+			return
+		}
+
+		header := req.Header.Get("Authorization")
+		value := strings.TrimPrefix(header, "Bearer ")
+		t, ok := findToken(value)
+		if !ok || value == header {
+			res.Header().Set("WWW-Authenticate", `Bearer realm="kapow"`)
+			httperror.ErrorJSON(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if t.Role < needed {
+			httperror.ErrorJSON(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), actorKey{}, t.identity())))
+	})
+}
+
+type actorKey struct{}
+
+// actor returns the identity of the client making req, or an empty string
+// when the control API doesn't require authentication
+func actor(req *http.Request) string {
+	a, _ := req.Context().Value(actorKey{}).(string)
+	return a
+}
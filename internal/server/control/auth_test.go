@@ -0,0 +1,218 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTokens(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "kapow-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tokens")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadTokensReadsTokensAndRoles(t *testing.T) {
+	path, cleanup := writeTokens(t, "# token role\nREADER read-only\n\n  ADMIN   admin  \n")
+	defer cleanup()
+
+	ts, err := LoadTokens(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Token{{Value: "READER", Role: RoleReadOnly}, {Value: "ADMIN", Role: RoleAdmin}}
+	if !reflect.DeepEqual(ts, expected) {
+		t.Errorf("Tokens mismatch. Expected: %v. Got: %v", expected, ts)
+	}
+}
+
+func TestLoadTokensReadsTheOptionalNames(t *testing.T) {
+	path, cleanup := writeTokens(t, "READER read-only\nADMIN admin alice\n")
+	defer cleanup()
+
+	ts, err := LoadTokens(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Token{{Value: "READER", Role: RoleReadOnly}, {Value: "ADMIN", Role: RoleAdmin, Name: "alice"}}
+	if !reflect.DeepEqual(ts, expected) {
+		t.Errorf("Tokens mismatch. Expected: %v. Got: %v", expected, ts)
+	}
+}
+
+func TestLoadTokensReportsTheLineOfTheErrors(t *testing.T) {
+	testCases := []struct {
+		content, expected string
+	}{
+		{"FOO admin\nBAR\n", ":2: expected a token, its role and optionally a name"},
+		{"FOO admin alice bob\n", ":1: expected a token, its role and optionally a name"},
+		{"FOO root\n", `:1: unknown role "root"`},
+		{"# nothing\n", ": no tokens found"},
+	}
+
+	for _, tc := range testCases {
+		path, cleanup := writeTokens(t, tc.content)
+		_, err := LoadTokens(path)
+		cleanup()
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Error mismatch. Expected: %q. Got: %v", tc.expected, err)
+		}
+	}
+}
+
+func TestLoadTokensFailsWhenTheFileDoesntExist(t *testing.T) {
+	if _, err := LoadTokens("/nonexistent/tokens"); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestNewTokenReturnsDifferentTokens(t *testing.T) {
+	a, _ := NewToken()
+	b, _ := NewToken()
+
+	if len(a) != 64 || a == b {
+		t.Errorf("Unexpected tokens: %q, %q", a, b)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	SetTokens([]Token{{Value: "READER", Role: RoleReadOnly}, {Value: "ADMIN", Role: RoleAdmin}})
+	defer SetTokens(nil)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := authenticate(ok)
+
+	testCases := []struct {
+		method, path, auth string
+		code               int
+		reason             string
+	}{
+		{http.MethodGet, "/routes", "", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/routes", "Bearer WRONG", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/routes", "READER", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/routes", "Bearer ", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/routes", "Bearer READER", http.StatusOK, ""},
+		{http.MethodGet, "/routes/FOO", "Bearer ADMIN", http.StatusOK, ""},
+		{http.MethodPost, "/routes", "Bearer READER", http.StatusForbidden, "Forbidden"},
+		{http.MethodDelete, "/routes/FOO", "Bearer READER", http.StatusForbidden, "Forbidden"},
+		{http.MethodPost, "/routes", "Bearer ADMIN", http.StatusOK, ""},
+		{http.MethodPost, "/routes:match", "Bearer READER", http.StatusOK, ""},
+		{http.MethodPost, "/routes:match", "", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/metrics", "", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/handlers", "Bearer READER", http.StatusForbidden, "Forbidden"},
+		{http.MethodGet, "/handlers/FOO", "Bearer READER", http.StatusForbidden, "Forbidden"},
+		{http.MethodGet, "/handlers", "Bearer ADMIN", http.StatusOK, ""},
+		{http.MethodGet, "/healthz", "", http.StatusOK, ""},
+		{http.MethodGet, "/readyz", "", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		resp := httptest.NewRecorder()
+
+		h.ServeHTTP(resp, req)
+
+		if tc.reason == "" {
+			if resp.Code != tc.code {
+				t.Errorf("%s %s %q: HTTP status mismatch. Expected: %d, got: %d", tc.method, tc.path, tc.auth, tc.code, resp.Code)
+			}
+			continue
+		}
+		for _, e := range checkErrorResponse(resp.Result(), tc.code, tc.reason) {
+			t.Errorf("%s %s %q: %s", tc.method, tc.path, tc.auth, e)
+		}
+	}
+}
+
+func TestAuthenticateAsksForABearerToken(t *testing.T) {
+	SetTokens([]Token{{Value: "ADMIN", Role: RoleAdmin}})
+	defer SetTokens(nil)
+	resp := httptest.NewRecorder()
+
+	authenticate(http.NotFoundHandler()).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/routes", nil))
+
+	if v := resp.Header().Get("WWW-Authenticate"); v != `Bearer realm="kapow"` {
+		t.Errorf("WWW-Authenticate header mismatch. Got: %q", v)
+	}
+}
+
+func TestAuthenticateAllowsEverythingWithoutTokens(t *testing.T) {
+	SetTokens(nil)
+	called := false
+	resp := httptest.NewRecorder()
+
+	authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })).
+		ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/routes", nil))
+
+	if !called {
+		t.Error("Request not allowed without tokens")
+	}
+}
+
+func TestAuthenticatePassesTheIdentityOfTheClient(t *testing.T) {
+	SetTokens([]Token{{Value: "ADMIN", Role: RoleAdmin, Name: "alice"}, {Value: "OTHER", Role: RoleAdmin}})
+	defer SetTokens(nil)
+
+	testCases := []struct {
+		auth, expected string
+	}{
+		{"Bearer ADMIN", "alice"},
+		{"Bearer OTHER", "token 1c55d9b8"},
+	}
+
+	for _, tc := range testCases {
+		var got string
+		req := httptest.NewRequest(http.MethodPost, "/routes", nil)
+		req.Header.Set("Authorization", tc.auth)
+
+		authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = actor(r) })).
+			ServeHTTP(httptest.NewRecorder(), req)
+
+		if got != tc.expected {
+			t.Errorf("Identity mismatch. Expected: %q. Got: %q", tc.expected, got)
+		}
+	}
+}
+
+func TestActorIsEmptyWithoutTokens(t *testing.T) {
+	SetTokens(nil)
+	var got string
+
+	authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = actor(r) })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/routes", nil))
+
+	if got != "" {
+		t.Errorf("Unexpected identity: %q", got)
+	}
+}
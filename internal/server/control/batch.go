@@ -0,0 +1,221 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/BBVA/kapow/internal/server/httperror"
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/user"
+)
+
+// batchOperation is one of the changes of a batch: the add, insert, remove
+// or update of a route.  Route holds the route to add or insert, along with
+// the index to insert it at, or the fields to update.  The id of an add or
+// insert is the one given to the new route, taken from the route or
+// generated if missing.
+type batchOperation struct {
+	Op    string          `json:"op"`
+	ID    string          `json:"id"`
+	Route json.RawMessage `json:"route"`
+}
+
+// funcBatch Method used to ask the route model module to change the whole
+// route list in a single step
+var funcBatch func(string, func([]model.Route) ([]model.Route, error)) ([]model.Route, error) = user.Routes.BatchBy
+
+// batchRoutes Handler that applies a list of operations to the route list.
+// Every operation is checked against the result of the previous ones, and
+// either all of them are applied at once or, if any is not valid, none is.
+// Returns the resulting list of routes, or 409 if an operation adds a route
+// with an id already in use.
+func batchRoutes(res http.ResponseWriter, req *http.Request) {
+	var ops []batchOperation
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(payload, &ops); err != nil {
+		httperror.ErrorJSON(res, "Malformed JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(ops) == 0 {
+		httperror.ErrorJSON(res, "Invalid Batch: no operations", http.StatusUnprocessableEntity)
+		return
+	}
+
+	created := map[string]bool{}
+	for i := range ops {
+		if ops[i].Op != "add" && ops[i].Op != "insert" {
+			continue
+		}
+		if ops[i].ID == "" {
+			// Malformed routes are reported when the operation is applied
+			var route model.Route
+			_ = json.Unmarshal(ops[i].Route, &route)
+			ops[i].ID = route.ID
+		}
+		if ops[i].ID == "" {
+			id, err := idGenerator()
+			if err != nil {
+				httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			ops[i].ID = id.String()
+		}
+		created[ops[i].ID] = true
+	}
+
+	routes, err := funcBatch(actor(req), func(rs []model.Route) ([]model.Route, error) {
+		return applyBatch(rs, ops)
+	})
+	if errors.Is(err, errIDInUse) {
+		httperror.ErrorJSON(res, "Invalid Batch: "+err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		httperror.ErrorJSON(res, "Invalid Batch: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	routeMutations.Inc("batch")
+
+	for i, r := range routes {
+		if created[r.ID] {
+			warnIfShadowed(res, r, routes[:i])
+		}
+	}
+
+	listBytes, _ := json.Marshal(routes)
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(listBytes)
+}
+
+// applyBatch Returns the result of applying ops to rs in order, or an error
+// naming the first operation that is not valid
+func applyBatch(rs []model.Route, ops []batchOperation) ([]model.Route, error) {
+	for n, op := range ops {
+		var err error
+		switch op.Op {
+		case "add", "insert":
+			rs, err = batchAdd(rs, op)
+		case "remove":
+			rs, err = batchRemove(rs, op)
+		case "update":
+			rs, err = batchUpdate(rs, op)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", n+1, err)
+		}
+	}
+	return rs, nil
+}
+
+// batchAdd Appends the route of op to rs, or inserts it at its index when
+// op is an insert
+func batchAdd(rs []model.Route, op batchOperation) ([]model.Route, error) {
+	var route model.Route
+	if len(op.Route) == 0 {
+		return nil, errors.New("route is mandatory")
+	}
+	if err := json.Unmarshal(op.Route, &route); err != nil {
+		return nil, fmt.Errorf("malformed route: %s", err)
+	}
+
+	index := len(rs)
+	if op.Op == "insert" {
+		if route.Index < 0 {
+			return nil, errors.New("index must not be negative")
+		}
+		if route.Index < index {
+			index = route.Index
+		}
+	}
+
+	if route.ID != "" && route.ID != op.ID {
+		return nil, fmt.Errorf("route id %q doesn't match the operation id %q", route.ID, op.ID)
+	}
+	route.ID = op.ID
+
+	if err := ValidateRoute(route); err != nil {
+		return nil, err
+	}
+	if err := ValidateID(route.ID); err != nil {
+		return nil, err
+	}
+	if err := checkClashes(route, rs); err != nil {
+		return nil, err
+	}
+	rs = append(rs, model.Route{})
+	copy(rs[index+1:], rs[index:])
+	rs[index] = route
+	return rs, nil
+}
+
+// batchRemove Removes the route with the id of op from rs
+func batchRemove(rs []model.Route, op batchOperation) ([]model.Route, error) {
+	i := routeIndex(rs, op.ID)
+	if i < 0 {
+		return nil, fmt.Errorf("route %q not found", op.ID)
+	}
+	return append(rs[:i], rs[i+1:]...), nil
+}
+
+// batchUpdate Changes the fields present in the route of op of the route
+// with its id, keeping the id and position of the route
+func batchUpdate(rs []model.Route, op batchOperation) ([]model.Route, error) {
+	i := routeIndex(rs, op.ID)
+	if i < 0 {
+		return nil, fmt.Errorf("route %q not found", op.ID)
+	}
+	if len(op.Route) == 0 {
+		return nil, errors.New("route is mandatory")
+	}
+
+	route := rs[i]
+	if err := json.Unmarshal(op.Route, &route); err != nil {
+		return nil, fmt.Errorf("malformed route: %s", err)
+	}
+	if route.ID != op.ID {
+		return nil, fmt.Errorf("route id %q doesn't match the operation id %q", route.ID, op.ID)
+	}
+
+	if err := ValidateRoute(route); err != nil {
+		return nil, err
+	}
+	if err := CheckDuplicate(route, rs); err != nil {
+		return nil, err
+	}
+
+	rs[i] = route
+	return rs, nil
+}
+
+// routeIndex Returns the position of the route with the given id in rs, or
+// -1 if there is none
+func routeIndex(rs []model.Route, id string) int {
+	for i, r := range rs {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
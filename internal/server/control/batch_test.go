@@ -0,0 +1,271 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// batchOn returns a funcBatch that applies the changes to a copy of rs, as
+// the route list does
+func batchOn(rs []model.Route) func(string, func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+	return func(_ string, apply func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+		c := make([]model.Route, len(rs))
+		copy(c, rs)
+		return apply(c)
+	}
+}
+
+func batchIDs(rs []model.Route) []string {
+	ids := []string{}
+	for _, r := range rs {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestBatchRoutesReturnsBadRequestWhenMalformedJSONBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(`{"op": "add"}`))
+	resp := httptest.NewRecorder()
+	funcBatch = func(string, func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+		t.Error("Batch applied")
+		return nil, nil
+	}
+
+	batchRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Malformed JSON") {
+		t.Error(e)
+	}
+}
+
+func TestBatchRoutesReturnsUnprocessableEntityWithoutOperations(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(`[]`))
+	resp := httptest.NewRecorder()
+
+	batchRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, "Invalid Batch: no operations") {
+		t.Error(e)
+	}
+}
+
+func TestBatchRoutesReturnsAnErrorNamingTheInvalidOperation(t *testing.T) {
+	stored := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+	idGenOrig := idGenerator
+	defer func() { idGenerator = idGenOrig }()
+	testCases := map[string]struct {
+		payload, reason string
+		code            int
+	}{
+		"unknown operation": {
+			`[{"op": "move", "id": "FOO"}]`,
+			`Invalid Batch: operation 1: unknown operation "move"`,
+			http.StatusUnprocessableEntity,
+		},
+		"unknown route": {
+			`[{"op": "remove", "id": "FOO"}, {"op": "remove", "id": "FOO"}]`,
+			`Invalid Batch: operation 2: route "FOO" not found`,
+			http.StatusUnprocessableEntity,
+		},
+		"missing route": {
+			`[{"op": "add"}]`,
+			`Invalid Batch: operation 1: route is mandatory`,
+			http.StatusUnprocessableEntity,
+		},
+		"invalid route": {
+			`[{"op": "add", "route": {"url_pattern": "/bar"}}]`,
+			`Invalid Batch: operation 1: method is mandatory`,
+			http.StatusUnprocessableEntity,
+		},
+		"negative index": {
+			`[{"op": "insert", "route": {"method": "GET", "url_pattern": "/bar", "index": -1}}]`,
+			`Invalid Batch: operation 1: index must not be negative`,
+			http.StatusUnprocessableEntity,
+		},
+		"duplicated route": {
+			`[{"op": "remove", "id": "FOO"}, {"op": "add", "route": {"method": "GET", "url_pattern": "/foo"}}, {"op": "add", "route": {"method": "GET", "url_pattern": "/foo"}}]`,
+			`Invalid Batch: operation 3: duplicated route GET /foo, already in route "aaaaaaaa-0000-0000-0000-000000000001"`,
+			http.StatusUnprocessableEntity,
+		},
+		"duplicated route with the id of the route": {
+			`[{"op": "add", "route": {"id": "FOO", "method": "GET", "url_pattern": "/foo"}}]`,
+			`Invalid Batch: operation 1: id "FOO" already in use`,
+			http.StatusConflict,
+		},
+		"mismatched ids": {
+			`[{"op": "add", "id": "BAR", "route": {"id": "BAZ", "method": "GET", "url_pattern": "/bar"}}]`,
+			`Invalid Batch: operation 1: route id "BAZ" doesn't match the operation id "BAR"`,
+			http.StatusUnprocessableEntity,
+		},
+		"mismatched ids on update": {
+			`[{"op": "update", "id": "FOO", "route": {"id": "BAZ", "command": "bar"}}]`,
+			`Invalid Batch: operation 1: route id "BAZ" doesn't match the operation id "FOO"`,
+			http.StatusUnprocessableEntity,
+		},
+	}
+
+	for name, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(tc.payload))
+		resp := httptest.NewRecorder()
+		funcBatch = batchOn(stored)
+		n := 0
+		idGenerator = func() (uuid.UUID, error) {
+			n++
+			return uuid.Parse(fmt.Sprintf("aaaaaaaa-0000-0000-0000-%012d", n))
+		}
+
+		batchRoutes(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), tc.code, tc.reason) {
+			t.Errorf("%s: %s", name, e)
+		}
+	}
+}
+
+func TestBatchRoutesAppliesTheOperationsInOrder(t *testing.T) {
+	stored := []model.Route{
+		{ID: "FOO", Method: "GET", Pattern: "/foo"},
+		{ID: "BAR", Method: "GET", Pattern: "/bar"},
+	}
+	payload := `[
+		{"op": "remove", "id": "FOO"},
+		{"op": "update", "id": "BAR", "route": {"command": "echo bar"}},
+		{"op": "add", "route": {"method": "GET", "url_pattern": "/foo"}},
+		{"op": "insert", "route": {"method": "POST", "url_pattern": "/foo", "index": 0}}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(payload))
+	resp := httptest.NewRecorder()
+	funcBatch = batchOn(stored)
+	before := routeMutations.Value("batch")
+
+	batchRoutes(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	respJson := []model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil || len(respJson) != 3 {
+		t.Fatalf("Response mismatch. Got: %s", resp.Body.String())
+	}
+	if r := respJson[0]; r.Method != "POST" || r.Pattern != "/foo" || r.ID == "" {
+		t.Errorf("Unexpected inserted route: %v", r)
+	}
+	if r := respJson[1]; r.ID != "BAR" || r.Pattern != "/bar" || r.Command != "echo bar" {
+		t.Errorf("Unexpected updated route: %v", r)
+	}
+	if r := respJson[2]; r.Method != "GET" || r.Pattern != "/foo" || r.ID == "" || r.ID == "FOO" {
+		t.Errorf("Unexpected added route: %v", r)
+	}
+	if v := routeMutations.Value("batch") - before; v != 1 {
+		t.Errorf("Mutation count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
+func TestBatchRoutesKeepsTheGivenIDs(t *testing.T) {
+	payload := `[
+		{"op": "add", "id": "hello", "route": {"method": "GET", "url_pattern": "/hello"}},
+		{"op": "update", "id": "hello", "route": {"command": "echo hello"}}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(payload))
+	resp := httptest.NewRecorder()
+	funcBatch = batchOn([]model.Route{})
+
+	batchRoutes(resp, req)
+
+	respJson := []model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil || len(respJson) != 1 {
+		t.Fatalf("Response mismatch. Got: %s", resp.Body.String())
+	}
+	if r := respJson[0]; r.ID != "hello" || r.Command != "echo hello" {
+		t.Errorf("Unexpected added route: %v", r)
+	}
+}
+
+func TestBatchRoutes409sWhenAnIDIsInUse(t *testing.T) {
+	payload := `[{"op": "add", "id": "FOO", "route": {"method": "GET", "url_pattern": "/hello"}}]`
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(payload))
+	resp := httptest.NewRecorder()
+	funcBatch = batchOn([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}})
+
+	batchRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusConflict, `Invalid Batch: operation 1: id "FOO" already in use`) {
+		t.Error(e)
+	}
+}
+
+func TestBatchRoutesRecordsTheActor(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(`[{"op": "remove", "id": "FOO"}]`))
+	req = req.WithContext(context.WithValue(req.Context(), actorKey{}, "alice"))
+	resp := httptest.NewRecorder()
+	var gotActor string
+	funcBatch = func(actor string, apply func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+		gotActor = actor
+		return apply([]model.Route{{ID: "FOO"}})
+	}
+
+	batchRoutes(resp, req)
+
+	if gotActor != "alice" {
+		t.Errorf("Actor mismatch. Expected: %q. Got: %q", "alice", gotActor)
+	}
+}
+
+func TestBatchRoutesDoesntApplyAnythingWhenAnOperationFails(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:batch", strings.NewReader(`[{"op": "remove", "id": "FOO"}]`))
+	resp := httptest.NewRecorder()
+	funcBatch = func(string, func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+		return nil, errors.New("route \"FOO\" not found")
+	}
+	before := routeMutations.Value("batch")
+
+	batchRoutes(resp, req)
+
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusUnprocessableEntity, resp.Code)
+	}
+	if v := routeMutations.Value("batch") - before; v != 0 {
+		t.Errorf("Mutation count mismatch. Expected: 0. Got: %v", v)
+	}
+}
+
+func TestApplyBatchInsertsPastTheEndAsAppend(t *testing.T) {
+	rs := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+	ops := []batchOperation{{Op: "insert", ID: "BAR", Route: json.RawMessage(`{"method": "GET", "url_pattern": "/bar", "index": 42}`)}}
+
+	rs, err := applyBatch(rs, ops)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ids := batchIDs(rs); !reflect.DeepEqual(ids, []string{"FOO", "BAR"}) {
+		t.Errorf("Unexpected route list: %v", ids)
+	}
+}
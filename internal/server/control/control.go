@@ -18,44 +18,86 @@ package control
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
 
+	"github.com/google/shlex"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"github.com/BBVA/kapow/internal/powfile"
 	"github.com/BBVA/kapow/internal/server/httperror"
+	"github.com/BBVA/kapow/internal/server/metrics"
 	"github.com/BBVA/kapow/internal/server/model"
 	"github.com/BBVA/kapow/internal/server/user"
 )
 
+// routeMutations Counts the changes made to the route table thru the
+// control API
+var routeMutations = metrics.NewCounterVec(
+	"kapow_route_mutations_total",
+	"Changes made to the route table thru the control API, by operation.",
+	"operation")
+
 // configRouter Populates the server mux with all the supported routes. The
-// server exposes list, get, delete and add route endpoints.
+// server exposes list, get, delete, add, insert, replace, update, import,
+// batch, match, history and rollback route endpoints, the list, get and
+// cancel endpoints of the handlers in flight, and the health and metrics
+// endpoints.
 func configRouter() *mux.Router {
 	r := mux.NewRouter()
+	addHealthRoutes(r)
+	r.HandleFunc("/routes/history", getHistory).
+		Methods(http.MethodGet)
+	r.HandleFunc("/routes/rollback", rollbackRoutes).
+		Methods(http.MethodPost)
 	r.HandleFunc("/routes/{id}", removeRoute).
 		Methods(http.MethodDelete)
 	r.HandleFunc("/routes/{id}", getRoute).
 		Methods(http.MethodGet)
+	r.HandleFunc("/routes/{id}", replaceRoute).
+		Methods(http.MethodPut)
+	r.HandleFunc("/routes/{id}", updateRoute).
+		Methods(http.MethodPatch)
 	r.HandleFunc("/routes", listRoutes).
 		Methods(http.MethodGet)
 	r.HandleFunc("/routes", addRoute).
 		Methods(http.MethodPost)
+	r.HandleFunc("/routes", insertRoute).
+		Methods(http.MethodPut)
+	r.HandleFunc("/routes:import", importRoutes).
+		Methods(http.MethodPost)
+	r.HandleFunc("/routes:batch", batchRoutes).
+		Methods(http.MethodPost)
+	r.HandleFunc("/routes:match", matchRoute).
+		Methods(http.MethodPost)
+	r.HandleFunc("/handlers", listHandlers).
+		Methods(http.MethodGet)
+	r.HandleFunc("/handlers/{id}", getHandler).
+		Methods(http.MethodGet)
+	r.HandleFunc("/handlers/{id}", cancelHandler).
+		Methods(http.MethodDelete)
 	return r
 }
 
 // funcRemove Method used to ask the route model module to delete a route
-var funcRemove func(id string) error = user.Routes.Delete
+var funcRemove func(actor, id string) error = user.Routes.DeleteBy
 
 // removeRoute Handler that removes the requested route.  If it doesn't exist,
 // returns 404 and an error entity
 func removeRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	id := vars["id"]
-	if err := funcRemove(id); err != nil {
+	if err := funcRemove(actor(req), id); err != nil {
 		httperror.ErrorJSON(res, "Route Not Found", http.StatusNotFound)
 		return
 	}
+	routeMutations.Inc("remove")
 
 	res.WriteHeader(http.StatusNoContent)
 }
@@ -64,21 +106,44 @@ func removeRoute(res http.ResponseWriter, req *http.Request) {
 var funcList func() []model.Route = user.Routes.List
 
 // listRoutes Handler that retrieves a list of the existing routes. An empty
-// list is returned when no routes exist
+// list is returned when no routes exist.  The list is returned as JSON, or
+// as a pow file adding the routes when the pow format is requested.  With
+// watch set, the list and its later changes are streamed instead.
 func listRoutes(res http.ResponseWriter, req *http.Request) {
+	if v := req.URL.Query().Get("watch"); v != "" {
+		watch, err := strconv.ParseBool(v)
+		if err != nil {
+			httperror.ErrorJSON(res, "Invalid Watch", http.StatusBadRequest)
+			return
+		}
+		if watch {
+			watchRoutes(res, req)
+			return
+		}
+	}
 
 	list := funcList()
 
-	listBytes, _ := json.Marshal(list)
-	res.Header().Set("Content-Type", "application/json")
-	_, _ = res.Write(listBytes)
+	switch req.URL.Query().Get("format") {
+	case "", "json":
+		listBytes, _ := json.Marshal(list)
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write(listBytes)
+	case "pow":
+		res.Header().Set("Content-Type", "text/x-shellscript; charset=utf-8")
+		_ = powfile.Export(res, list)
+	default:
+		httperror.ErrorJSON(res, "Invalid Format", http.StatusBadRequest)
+	}
 }
 
-// funcAdd Method used to ask the route model module to append a new route
-var funcAdd func(model.Route) model.Route = user.Routes.Append
+// funcAdd Method used to ask the route model module to append a new route,
+// once checked against the routes it is going to be served along with
+var funcAdd func(string, model.Route, func([]model.Route) error) (model.Route, error) = user.Routes.AppendBy
 
-// idGenerator UUID generator for new routes
-var idGenerator = uuid.NewUUID
+// idGenerator UUID generator for new routes.  Random UUIDs are used, so
+// route IDs can't be guessed.
+var idGenerator = uuid.NewRandom
 
 // pathValidator Validates that a path complies with the gorilla mux
 // requirements
@@ -86,8 +151,75 @@ var pathValidator func(string) error = func(path string) error {
 	return mux.NewRouter().NewRoute().BuildOnly().Path(path).GetError()
 }
 
+// validMethod Matches the HTTP methods a route can have: tokens as defined
+// by RFC 7230, in upper case
+var validMethod = regexp.MustCompile("^[A-Z0-9!#$%&'*+.^_`|~-]+$")
+
+// lookPath Finds the executable of an entrypoint as the spawned processes
+// will
+var lookPath = exec.LookPath
+
+// ValidateRoute Checks that a route can be added to the server.  The same
+// checks are made by the add route endpoint and the server configuration
+// file
+func ValidateRoute(route model.Route) error {
+	if route.Method == "" {
+		return errors.New("method is mandatory")
+	}
+
+	if !validMethod.MatchString(route.Method) {
+		return fmt.Errorf("invalid method %q", route.Method)
+	}
+
+	if route.Pattern == "" {
+		return errors.New("url_pattern is mandatory")
+	}
+
+	if err := pathValidator(route.Pattern); err != nil {
+		return fmt.Errorf("invalid url_pattern %q: %s", route.Pattern, err)
+	}
+
+	if route.Entrypoint != "" {
+		args, err := shlex.Split(route.Entrypoint)
+		if err != nil {
+			return fmt.Errorf("invalid entrypoint %q: %s", route.Entrypoint, err)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("invalid entrypoint %q: no executable", route.Entrypoint)
+		}
+		if _, err := lookPath(args[0]); err != nil {
+			return fmt.Errorf("entrypoint executable %q not found", args[0])
+		}
+	}
+
+	return nil
+}
+
+// AddRoutes Appends a list of already validated routes, giving a new id to
+// the ones that lack it.  Fails on the first route whose id or method and
+// url_pattern are already in use by one of the routes being served.
+func AddRoutes(routes []model.Route) error {
+	for _, route := range routes {
+		if route.ID == "" {
+			id, err := idGenerator()
+			if err != nil {
+				return err
+			}
+			route.ID = id.String()
+		}
+		_, err := funcAdd("", route, func(rs []model.Route) error {
+			return checkClashes(route, rs)
+		})
+		if err != nil {
+			return fmt.Errorf("invalid route %q: %s", route.ID, err)
+		}
+	}
+	return nil
+}
+
 // addRoute Handler that adds a new route. Makes all parameter validation and
-// creates the a new is for the route
+// creates a new id for the route, unless one is given.  Returns 409 if the
+// given id is already in use.
 func addRoute(res http.ResponseWriter, req *http.Request) {
 	var route model.Route
 
@@ -98,31 +230,94 @@ func addRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if route.Method == "" {
-		httperror.ErrorJSON(res, "Invalid Route", http.StatusUnprocessableEntity)
+	if err := ValidateRoute(route); err != nil {
+		invalidRoute(res, err)
 		return
 	}
-
-	if route.Pattern == "" {
-		httperror.ErrorJSON(res, "Invalid Route", http.StatusUnprocessableEntity)
+	if err := ValidateID(route.ID); err != nil {
+		invalidRoute(res, err)
 		return
 	}
 
-	err = pathValidator(route.Pattern)
+	if route.ID == "" {
+		id, err := idGenerator()
+		if err != nil {
+			httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		route.ID = id.String()
+	}
+	var earlier []model.Route
+	created, err := funcAdd(actor(req), route, func(rs []model.Route) error {
+		earlier = rs
+		return checkClashes(route, rs)
+	})
 	if err != nil {
-		httperror.ErrorJSON(res, "Invalid Route", http.StatusUnprocessableEntity)
+		rejectRoute(res, err)
 		return
 	}
+	warnIfShadowed(res, created, earlier)
+	routeMutations.Inc("add")
+	createdBytes, _ := json.Marshal(created)
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusCreated)
+	_, _ = res.Write(createdBytes)
+}
 
-	id, err := idGenerator()
+// funcInsert Method used to ask the route model module to insert a new route
+// at a given position, once checked as in funcAdd
+var funcInsert func(string, model.Route, int, func([]model.Route) error) (model.Route, error) = user.Routes.InsertBy
+
+// insertRoute Handler that inserts a new route at the position given by its
+// index.  Indexes past the end of the route list append the route, and
+// negative ones are rejected.  The id is given or generated as in addRoute.
+func insertRoute(res http.ResponseWriter, req *http.Request) {
+	var route model.Route
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	err := json.Unmarshal(payload, &route)
 	if err != nil {
-		httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+		httperror.ErrorJSON(res, "Malformed JSON", http.StatusBadRequest)
 		return
 	}
 
-	route.ID = id.String()
+	if route.Index < 0 {
+		invalidRoute(res, errors.New("index must not be negative"))
+		return
+	}
 
-	created := funcAdd(route)
+	if err := ValidateRoute(route); err != nil {
+		invalidRoute(res, err)
+		return
+	}
+	if err := ValidateID(route.ID); err != nil {
+		invalidRoute(res, err)
+		return
+	}
+
+	if route.ID == "" {
+		id, err := idGenerator()
+		if err != nil {
+			httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		route.ID = id.String()
+	}
+	var earlier []model.Route
+	created, err := funcInsert(actor(req), route, route.Index, func(rs []model.Route) error {
+		earlier = rs
+		return checkClashes(route, rs)
+	})
+	if err != nil {
+		rejectRoute(res, err)
+		return
+	}
+	if created.Index < len(earlier) {
+		earlier = earlier[:created.Index]
+	}
+	warnIfShadowed(res, created, earlier)
+	routeMutations.Inc("insert")
 	createdBytes, _ := json.Marshal(created)
 
 	res.Header().Set("Content-Type", "application/json")
@@ -145,3 +340,215 @@ func getRoute(res http.ResponseWriter, req *http.Request) {
 		_, _ = res.Write(rBytes)
 	}
 }
+
+// funcUpdate Method used to ask the route model module to change a route in
+// place
+var funcUpdate func(string, string, func(*model.Route, []model.Route) error) (model.Route, error) = user.Routes.UpdateBy
+
+// replaceRoute Handler that replaces the definition of a route with the one
+// given, keeping its id and position
+func replaceRoute(res http.ResponseWriter, req *http.Request) {
+	var route model.Route
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(payload, &route); err != nil {
+		httperror.ErrorJSON(res, "Malformed JSON", http.StatusBadRequest)
+		return
+	}
+
+	changeRoute(res, req, "replace", func(r *model.Route) error {
+		route.PowFile = r.PowFile
+		*r = route
+		return nil
+	})
+}
+
+// updateRoute Handler that changes only the fields of a route present in the
+// request, keeping its id and position
+func updateRoute(res http.ResponseWriter, req *http.Request) {
+	var route model.Route
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(payload, &route); err != nil {
+		httperror.ErrorJSON(res, "Malformed JSON", http.StatusBadRequest)
+		return
+	}
+
+	changeRoute(res, req, "update", func(r *model.Route) error {
+		return json.Unmarshal(payload, r)
+	})
+}
+
+// changeRoute Applies change to the route in the request, returning 422 if
+// the resulting route is not valid or has another id, and 404 if it doesn't
+// exist
+func changeRoute(res http.ResponseWriter, req *http.Request, operation string, change func(*model.Route) error) {
+	var invalid error
+	id := mux.Vars(req)["id"]
+	changed, err := funcUpdate(actor(req), id, func(r *model.Route, rs []model.Route) error {
+		if err := change(r); err != nil {
+			return err
+		}
+		if r.ID != "" && r.ID != id {
+			invalid = fmt.Errorf("route id %q doesn't match the id in the URL %q", r.ID, id)
+		} else if invalid = ValidateRoute(*r); invalid == nil {
+			invalid = CheckDuplicate(*r, rs)
+		}
+		return invalid
+	})
+	if invalid != nil {
+		invalidRoute(res, invalid)
+		return
+	} else if err != nil {
+		httperror.ErrorJSON(res, "Route Not Found", http.StatusNotFound)
+		return
+	}
+	routeMutations.Inc(operation)
+
+	changedBytes, _ := json.Marshal(changed)
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(changedBytes)
+}
+
+// funcReplaceAll Method used to ask the route model module to replace the
+// whole route list
+var funcReplaceAll func(string, []model.Route, func([]model.Route) error) error = user.Routes.ReplaceAllBy
+
+// funcMerge Method used to ask the route model module to merge a list of
+// routes into the current one
+var funcMerge func(string, []model.Route, func([]model.Route) error) error = user.Routes.MergeBy
+
+// importRoutes Handler that loads a list of routes, as returned by
+// listRoutes, into the route list.  With the replace mode the list becomes
+// the whole route list; with the merge mode, the default, the routes with
+// an existing id replace it in place and the rest are appended.  Either all
+// the routes are imported or none is.  The route list decides which pow
+// file owns each imported route, if any.
+func importRoutes(res http.ResponseWriter, req *http.Request) {
+	var routes []model.Route
+
+	mode := req.URL.Query().Get("mode")
+	if mode != "" && mode != "merge" && mode != "replace" {
+		httperror.ErrorJSON(res, "Invalid Mode", http.StatusBadRequest)
+		return
+	}
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(payload, &routes); err != nil {
+		httperror.ErrorJSON(res, "Malformed JSON", http.StatusBadRequest)
+		return
+	}
+
+	ids := map[string]bool{}
+	for i := range routes {
+		if err := ValidateRoute(routes[i]); err != nil {
+			invalidRoute(res, err)
+			return
+		}
+		if err := ValidateID(routes[i].ID); err != nil {
+			invalidRoute(res, err)
+			return
+		}
+		if ids[routes[i].ID] {
+			invalidRoute(res, fmt.Errorf("duplicated route id %q", routes[i].ID))
+			return
+		}
+		if err := CheckDuplicate(routes[i], routes[:i]); err != nil {
+			invalidRoute(res, err)
+			return
+		}
+		if routes[i].ID == "" {
+			id, err := idGenerator()
+			if err != nil {
+				httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			routes[i].ID = id.String()
+		}
+		ids[routes[i].ID] = true
+	}
+
+	var err error
+	if mode == "replace" {
+		err = funcReplaceAll(actor(req), routes, nil)
+	} else {
+		// When merging, the routes must not clash with the ones they don't
+		// replace either
+		err = funcMerge(actor(req), routes, func(current []model.Route) error {
+			kept := []model.Route{}
+			for _, r := range current {
+				if !ids[r.ID] {
+					kept = append(kept, r)
+				}
+			}
+			for _, r := range routes {
+				if err := CheckDuplicate(r, kept); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		invalidRoute(res, err)
+		return
+	}
+	routeMutations.Inc("import")
+
+	listBytes, _ := json.Marshal(funcList())
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(listBytes)
+}
+
+// funcHistory Method used to ask the route model module for the changes made
+// to the route list
+var funcHistory func() []user.Revision = user.Routes.History
+
+// getHistory Handler that retrieves the last changes made to the route list,
+// oldest first, each one with the route list before and after it
+func getHistory(res http.ResponseWriter, req *http.Request) {
+	historyBytes, _ := json.Marshal(funcHistory())
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(historyBytes)
+}
+
+// funcRollback Method used to ask the route model module to restore the
+// route list of a previous version
+var funcRollback func(string, int) error = user.Routes.Rollback
+
+// rollbackRoutes Handler that restores the route list as it was right after
+// the version given, in a single step.  Returns 404 if the version is not
+// in the history.
+func rollbackRoutes(res http.ResponseWriter, req *http.Request) {
+	version, err := strconv.Atoi(req.URL.Query().Get("version"))
+	if err != nil || version < 1 {
+		httperror.ErrorJSON(res, "Invalid Version", http.StatusBadRequest)
+		return
+	}
+
+	if err := funcRollback(actor(req), version); err != nil {
+		httperror.ErrorJSON(res, "Version Not Found", http.StatusNotFound)
+		return
+	}
+	routeMutations.Inc("rollback")
+
+	listBytes, _ := json.Marshal(funcList())
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(listBytes)
+}
+
+// invalidRoute Responds with a 422 error naming the reason why the route is
+// not valid
+func invalidRoute(res http.ResponseWriter, err error) {
+	httperror.ErrorJSON(res, "Invalid Route: "+err.Error(), http.StatusUnprocessableEntity)
+}
+
+// rejectRoute Responds to the addition of a route that clashes with another
+// one: 409 if its id is in use, and 422 otherwise
+func rejectRoute(res http.ResponseWriter, err error) {
+	if errors.Is(err, errIDInUse) {
+		httperror.ErrorJSON(res, "Route ID In Use", http.StatusConflict)
+	} else {
+		invalidRoute(res, err)
+	}
+}
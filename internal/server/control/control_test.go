@@ -17,6 +17,7 @@
 package control
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -31,6 +32,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/BBVA/kapow/internal/server/httperror"
+	"github.com/BBVA/kapow/internal/server/metrics"
 	"github.com/BBVA/kapow/internal/server/model"
 	"github.com/BBVA/kapow/internal/server/user"
 )
@@ -66,13 +68,28 @@ func TestConfigRouterHasRoutesWellConfigured(t *testing.T) {
 		vars            []string
 	}{
 		{"/routes/FOO", http.MethodGet, reflect.ValueOf(getRoute).Pointer(), true, []string{"id"}},
-		{"/routes/FOO", http.MethodPut, 0, false, []string{}},
+		{"/routes/FOO", http.MethodPut, reflect.ValueOf(replaceRoute).Pointer(), true, []string{"id"}},
+		{"/routes/FOO", http.MethodPatch, reflect.ValueOf(updateRoute).Pointer(), true, []string{"id"}},
 		{"/routes/FOO", http.MethodPost, 0, false, []string{}},
 		{"/routes/FOO", http.MethodDelete, reflect.ValueOf(removeRoute).Pointer(), true, []string{"id"}},
 		{"/routes", http.MethodGet, reflect.ValueOf(listRoutes).Pointer(), true, []string{}},
-		{"/routes", http.MethodPut, 0, false, []string{}},
+		{"/routes", http.MethodPut, reflect.ValueOf(insertRoute).Pointer(), true, []string{}},
 		{"/routes", http.MethodPost, reflect.ValueOf(addRoute).Pointer(), true, []string{}},
 		{"/routes", http.MethodDelete, 0, false, []string{}},
+		{"/routes:import", http.MethodPost, reflect.ValueOf(importRoutes).Pointer(), true, []string{}},
+		{"/routes:import", http.MethodGet, 0, false, []string{}},
+		{"/routes:batch", http.MethodPost, reflect.ValueOf(batchRoutes).Pointer(), true, []string{}},
+		{"/routes:match", http.MethodPost, reflect.ValueOf(matchRoute).Pointer(), true, []string{}},
+		{"/handlers", http.MethodGet, reflect.ValueOf(listHandlers).Pointer(), true, []string{}},
+		{"/handlers", http.MethodPost, 0, false, []string{}},
+		{"/handlers/FOO", http.MethodGet, reflect.ValueOf(getHandler).Pointer(), true, []string{"id"}},
+		{"/handlers/FOO", http.MethodDelete, reflect.ValueOf(cancelHandler).Pointer(), true, []string{"id"}},
+		{"/routes/history", http.MethodGet, reflect.ValueOf(getHistory).Pointer(), true, []string{}},
+		{"/routes/rollback", http.MethodPost, reflect.ValueOf(rollbackRoutes).Pointer(), true, []string{}},
+		{"/healthz", http.MethodGet, reflect.ValueOf(healthz).Pointer(), true, []string{}},
+		{"/readyz", http.MethodGet, reflect.ValueOf(readyz).Pointer(), true, []string{}},
+		{"/readyz", http.MethodPost, 0, false, []string{}},
+		{"/metrics", http.MethodGet, reflect.ValueOf(metrics.Handler).Pointer(), true, []string{}},
 	}
 	r := configRouter()
 
@@ -136,26 +153,29 @@ func TestAddRouteReturnsBadRequestWhenMalformedJSONBody(t *testing.T) {
 
 func TestAddRouteReturns422ErrorWhenMandatoryFieldsMissing(t *testing.T) {
 	tc := []struct {
-		payload, testCase string
-		testMustFail      bool
+		payload, testCase, reason string
+		testMustFail              bool
 	}{
-		{`{}`, "EmptyBody", true},
+		{`{}`, "EmptyBody", "Invalid Route: method is mandatory", true},
 		{`{
 	  "method": "GET"
 	  }`,
 			"Missing url_pattern",
+			"Invalid Route: url_pattern is mandatory",
 			true,
 		},
 		{`{
 	  "url_pattern": "/hello"
 	  }`,
 			"Missing method",
+			"Invalid Route: method is mandatory",
 			true,
 		},
 		{`{
 	  "method": "GET",
 	  "url_pattern": "/hello"
 	  }`,
+			"",
 			"",
 			false,
 		},
@@ -164,6 +184,7 @@ func TestAddRouteReturns422ErrorWhenMandatoryFieldsMissing(t *testing.T) {
 	  "url_pattern": "/hello",
 	  "entrypoint": ""
 	  }`,
+			"",
 			"",
 			false,
 		},
@@ -172,6 +193,7 @@ func TestAddRouteReturns422ErrorWhenMandatoryFieldsMissing(t *testing.T) {
 	  "url_pattern": "/hello",
 	  "command": ""
 	  }`,
+			"",
 			"",
 			false,
 		},
@@ -181,6 +203,7 @@ func TestAddRouteReturns422ErrorWhenMandatoryFieldsMissing(t *testing.T) {
 	  "entrypoint": "",
 	  "command": ""
 	  }`,
+			"",
 			"",
 			false,
 		},
@@ -189,11 +212,12 @@ func TestAddRouteReturns422ErrorWhenMandatoryFieldsMissing(t *testing.T) {
 	for _, test := range tc {
 		req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(test.payload))
 		resp := httptest.NewRecorder()
+		funcAdd = addOn([]model.Route{}, func(_ string, input model.Route) model.Route { return input })
 
 		addRoute(resp, req)
 		r := resp.Result()
 		if test.testMustFail {
-			for _, e := range checkErrorResponse(r, http.StatusUnprocessableEntity, "Invalid Route") {
+			for _, e := range checkErrorResponse(r, http.StatusUnprocessableEntity, test.reason) {
 				t.Error(e)
 			}
 		} else if !test.testMustFail {
@@ -218,11 +242,11 @@ func TestAddRouteGeneratesRouteID(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
 	resp := httptest.NewRecorder()
 	var genID string
-	funcAdd = func(input model.Route) model.Route {
+	funcAdd = addOn([]model.Route{}, func(_ string, input model.Route) model.Route {
 		genID = input.ID
 		input.Index = 0
 		return input
-	}
+	})
 	origPathValidator := pathValidator
 	defer func() { pathValidator = origPathValidator }()
 	pathValidator = func(path string) error { return nil }
@@ -234,6 +258,17 @@ func TestAddRouteGeneratesRouteID(t *testing.T) {
 	}
 }
 
+func TestIDGeneratorIsRandom(t *testing.T) {
+	id, err := idGenerator()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if id.Version() != 4 {
+		t.Errorf("UUID version mismatch. Expected: 4. Got: %d", id.Version())
+	}
+}
+
 func TestAddRoute500sWhenIDGeneratorFails(t *testing.T) {
 	reqPayload := `{
 	"method": "GET",
@@ -243,6 +278,7 @@ func TestAddRoute500sWhenIDGeneratorFails(t *testing.T) {
   }`
 	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
 	resp := httptest.NewRecorder()
+	funcList = func() []model.Route { return []model.Route{} }
 
 	origPathValidator := pathValidator
 	defer func() { pathValidator = origPathValidator }()
@@ -273,7 +309,7 @@ func TestAddRouteReturnsCreated(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
 	resp := httptest.NewRecorder()
 	var genID string
-	funcAdd = func(input model.Route) model.Route {
+	funcAdd = addOn([]model.Route{}, func(_ string, input model.Route) model.Route {
 		expected := model.Route{ID: input.ID, Method: "GET", Pattern: "/hello", Entrypoint: "/bin/sh -c", Command: "echo Hello World | kapow set /response/body"}
 		if input == expected {
 			genID = input.ID
@@ -282,7 +318,7 @@ func TestAddRouteReturnsCreated(t *testing.T) {
 		}
 
 		return model.Route{}
-	}
+	})
 	origPathValidator := pathValidator
 	defer func() { pathValidator = origPathValidator }()
 	pathValidator = func(path string) error { return nil }
@@ -323,18 +359,373 @@ func TestAddRoute422sWhenInvalidRoute(t *testing.T) {
 
 	addRoute(resp, req)
 
-	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, "Invalid Route") {
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, `Invalid Route: invalid url_pattern "/he{{o": Invalid route`) {
+		t.Error(e)
+	}
+}
+
+func TestValidateRouteReportsTheOffendingField(t *testing.T) {
+	testCases := []struct {
+		route    model.Route
+		expected string
+	}{
+		{model.Route{Pattern: "/hello"}, "method is mandatory"},
+		{model.Route{Method: "GET"}, "url_pattern is mandatory"},
+		{model.Route{Method: "GET", Pattern: "/he{{o"}, `invalid url_pattern "/he{{o": Invalid route`},
+		{model.Route{Method: "get", Pattern: "/hello"}, `invalid method "get"`},
+		{model.Route{Method: "GET POST", Pattern: "/hello"}, `invalid method "GET POST"`},
+	}
+	origPathValidator := pathValidator
+	defer func() { pathValidator = origPathValidator }()
+	pathValidator = func(path string) error { return errors.New("Invalid route") }
+
+	for _, tc := range testCases {
+		if err := ValidateRoute(tc.route); err == nil || err.Error() != tc.expected {
+			t.Errorf("Error mismatch. Expected: %q. Got: %v", tc.expected, err)
+		}
+	}
+}
+
+func TestValidateRouteReportsInvalidEntrypoints(t *testing.T) {
+	testCases := []struct {
+		entrypoint, expected string
+	}{
+		{`/bin/sh "-c`, `invalid entrypoint "/bin/sh \"-c": EOF found when expecting closing quote`},
+		{"  ", `invalid entrypoint "  ": no executable`},
+		{"/nonexistent/sh -c", `entrypoint executable "/nonexistent/sh" not found`},
+	}
+
+	for _, tc := range testCases {
+		err := ValidateRoute(model.Route{Method: "GET", Pattern: "/hello", Entrypoint: tc.entrypoint})
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("Error mismatch. Expected: %q. Got: %v", tc.expected, err)
+		}
+	}
+}
+
+func TestValidateRouteAcceptsAValidRoute(t *testing.T) {
+	if err := ValidateRoute(model.Route{Method: "GET", Pattern: "/hello/{name}"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidateRouteAcceptsAnEntrypointInThePath(t *testing.T) {
+	origLookPath := lookPath
+	defer func() { lookPath = origLookPath }()
+	var looked string
+	lookPath = func(file string) (string, error) {
+		looked = file
+		return "/usr/bin/" + file, nil
+	}
+
+	if err := ValidateRoute(model.Route{Method: "PROPFIND", Pattern: "/", Entrypoint: "python3 -c"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if looked != "python3" {
+		t.Errorf(`Executable mismatch. Expected: "python3". Got: %q`, looked)
+	}
+}
+
+func TestAddRoute422sWhenTheRouteIsDuplicated(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcAdd = addOn([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/hello"}}, func(_ string, input model.Route) model.Route {
+		t.Error("Duplicated route added")
+		return input
+	})
+
+	addRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, `Invalid Route: duplicated route GET /hello, already in route "FOO"`) {
+		t.Error(e)
+	}
+}
+
+func TestAddRouteKeepsTheGivenID(t *testing.T) {
+	reqPayload := `{"id": "hello", "method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	var gotID string
+	funcAdd = addOn([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}, func(_ string, input model.Route) model.Route {
+		gotID = input.ID
+		return input
+	})
+
+	addRoute(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusCreated, resp.Code)
+	}
+	if gotID != "hello" {
+		t.Errorf(`ID mismatch. Expected: "hello". Got: %q`, gotID)
+	}
+}
+
+func TestAddRoute409sWhenTheIDIsInUse(t *testing.T) {
+	reqPayload := `{"id": "FOO", "method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcAdd = addOn([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}, func(_ string, input model.Route) model.Route {
+		t.Error("Route added with an id in use")
+		return input
+	})
+
+	addRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusConflict, "Route ID In Use") {
+		t.Error(e)
+	}
+}
+
+func TestAddRoute422sWhenTheIDIsInvalid(t *testing.T) {
+	reqPayload := `{"id": "history", "method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcAdd = addOn([]model.Route{}, func(_ string, input model.Route) model.Route {
+		t.Error("Route added with an invalid id")
+		return input
+	})
+
+	addRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, `Invalid Route: invalid id "history": reserved`) {
 		t.Error(e)
 	}
 }
 
+func TestAddRouteWarnsWhenTheRouteIsShadowedIfEnabled(t *testing.T) {
+	defer SetShadowWarnings(false)
+	for _, enabled := range []bool{false, true} {
+		SetShadowWarnings(enabled)
+		req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(`{"method": "GET", "url_pattern": "/hello"}`))
+		resp := httptest.NewRecorder()
+		funcAdd = addOn([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/{path}"}}, func(_ string, input model.Route) model.Route { return input })
+
+		addRoute(resp, req)
+
+		if resp.Code != http.StatusCreated {
+			t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusCreated, resp.Code)
+		}
+		if w := resp.Header().Get("Warning"); (w != "") != enabled {
+			t.Errorf("Unexpected Warning header with warnings enabled=%v: %q", enabled, w)
+		}
+	}
+}
+
+func TestInsertRouteOnlyWarnsAboutTheRoutesBeforeIt(t *testing.T) {
+	defer SetShadowWarnings(false)
+	SetShadowWarnings(true)
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(`{"method": "GET", "url_pattern": "/hello", "index": 1}`))
+	resp := httptest.NewRecorder()
+	funcInsert = insertOn([]model.Route{
+		{ID: "FOO", Method: "GET", Pattern: "/foo"},
+		{ID: "BAR", Method: "GET", Pattern: "/{path}"},
+	}, func(_ string, input model.Route, _ int) model.Route { return input })
+
+	insertRoute(resp, req)
+
+	if w := resp.Header().Get("Warning"); w != "" {
+		t.Errorf("Unexpected Warning header: %q", w)
+	}
+}
+
+func TestAddRoutesKeepsGivenIDsAndGeneratesMissingOnes(t *testing.T) {
+	origFuncAdd := funcAdd
+	defer func() { funcAdd = origFuncAdd }()
+	var added []model.Route
+	funcAdd = addOn(nil, func(_ string, input model.Route) model.Route {
+		added = append(added, input)
+		return input
+	})
+
+	err := AddRoutes([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}, {Method: "GET", Pattern: "/bar"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(added) != 2 {
+		t.Fatalf("Added routes mismatch. Expected: 2. Got: %d", len(added))
+	}
+	if added[0].ID != "FOO" {
+		t.Errorf(`ID mismatch. Expected: "FOO". Got: %q`, added[0].ID)
+	}
+	if _, err := uuid.Parse(added[1].ID); err != nil {
+		t.Error("ID not generated properly")
+	}
+}
+
+func TestAddRoutesFailsWhenARouteClashesWithTheRoutesServed(t *testing.T) {
+	origFuncAdd := funcAdd
+	defer func() { funcAdd = origFuncAdd }()
+	served := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+	funcAdd = addOn(served, func(_ string, input model.Route) model.Route {
+		served = append(served, input)
+		return input
+	})
+
+	testCases := map[string]struct {
+		routes []model.Route
+		err    string
+	}{
+		"id in use": {
+			[]model.Route{{ID: "FOO", Method: "GET", Pattern: "/bar"}},
+			`invalid route "FOO": id "FOO" already in use`,
+		},
+		"duplicated route": {
+			[]model.Route{{ID: "BAR", Method: "GET", Pattern: "/foo"}},
+			`invalid route "BAR": duplicated route GET /foo, already in route "FOO"`,
+		},
+	}
+	for name, tc := range testCases {
+		if err := AddRoutes(tc.routes); err == nil || err.Error() != tc.err {
+			t.Errorf("%s: Error mismatch. Expected: %q. Got: %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestAddRoutesFailsWhenIDGeneratorFails(t *testing.T) {
+	origFuncAdd := funcAdd
+	defer func() { funcAdd = origFuncAdd }()
+	funcAdd = addOn(nil, func(_ string, input model.Route) model.Route {
+		t.Error("Route added despite the ID generator failure")
+		return input
+	})
+	idGenOrig := idGenerator
+	defer func() { idGenerator = idGenOrig }()
+	idGenerator = func() (uuid.UUID, error) {
+		var uuid uuid.UUID
+		return uuid, errors.New("End of Time reached")
+	}
+
+	if err := AddRoutes([]model.Route{{Method: "GET", Pattern: "/bar"}}); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestInsertRouteReturnsBadRequestWhenMalformedJSONBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(`{"method": "GET",`))
+	resp := httptest.NewRecorder()
+
+	insertRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Malformed JSON") {
+		t.Error(e)
+	}
+}
+
+func TestInsertRoute422sWhenInvalidRoute(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(`{"method": "GET"}`))
+	resp := httptest.NewRecorder()
+
+	insertRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, "Invalid Route: url_pattern is mandatory") {
+		t.Error(e)
+	}
+}
+
+func TestInsertRoute422sWhenIndexIsNegative(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello", "index": -1}`
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcInsert = insertOn(nil, func(_ string, input model.Route, index int) model.Route {
+		t.Error("Route with a negative index inserted")
+		return input
+	})
+
+	insertRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, "Invalid Route: index must not be negative") {
+		t.Error(e)
+	}
+}
+
+func TestInsertRoute500sWhenIDGeneratorFails(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcList = func() []model.Route { return []model.Route{} }
+	idGenOrig := idGenerator
+	defer func() { idGenerator = idGenOrig }()
+	idGenerator = func() (uuid.UUID, error) {
+		var uuid uuid.UUID
+		return uuid, errors.New(
+			"End of Time reached; Try again before, or in the next Big Bang cycle")
+	}
+
+	insertRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusInternalServerError, "Internal Server Error") {
+		t.Error(e)
+	}
+}
+
+func TestInsertRouteInsertsAtTheGivenIndex(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello", "command": "echo Hello", "index": 3}`
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	gotIndex := -1
+	funcInsert = insertOn([]model.Route{}, func(_ string, input model.Route, index int) model.Route {
+		gotIndex = index
+		input.Index = 1
+		return input
+	})
+
+	insertRoute(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusCreated, resp.Code)
+	}
+	if gotIndex != 3 {
+		t.Errorf("Index mismatch. Expected: 3, got: %d", gotIndex)
+	}
+	respJson := model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil {
+		t.Fatalf("Invalid JSON response. %s", resp.Body.String())
+	}
+	if respJson.ID == "" || respJson.Index != 1 || respJson.Command != "echo Hello" {
+		t.Errorf("Response mismatch. Got: %#v", respJson)
+	}
+}
+
+func TestInsertRoute409sWhenTheIDIsInUse(t *testing.T) {
+	reqPayload := `{"id": "FOO", "method": "GET", "url_pattern": "/hello", "index": 0}`
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcInsert = insertOn([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}, func(_ string, input model.Route, _ int) model.Route {
+		t.Error("Route inserted with an id in use")
+		return input
+	})
+
+	insertRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusConflict, "Route ID In Use") {
+		t.Error(e)
+	}
+}
+
+func TestInsertRouteCountsTheMutation(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPut, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcInsert = insertOn([]model.Route{}, func(_ string, input model.Route, index int) model.Route { return input })
+	before := routeMutations.Value("insert")
+
+	insertRoute(resp, req)
+
+	if v := routeMutations.Value("insert") - before; v != 1 {
+		t.Errorf("Mutation count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
 func TestRemoveRouteReturnsNotFound(t *testing.T) {
 	req := httptest.NewRequest(http.MethodDelete, "/routes/ROUTE_XXXXXXXXXXXXXXXXXX", nil)
 	resp := httptest.NewRecorder()
 	handler := mux.NewRouter()
 	handler.HandleFunc("/routes/{id}", removeRoute).
 		Methods("DELETE")
-	funcRemove = func(id string) error {
+	funcRemove = func(_, id string) error {
 		if id == "ROUTE_XXXXXXXXXXXXXXXXXX" {
 			return errors.New(id)
 		}
@@ -356,7 +747,7 @@ func TestRemoveRouteReturnsNoContent(t *testing.T) {
 	handler.HandleFunc("/routes/{id}", removeRoute).
 		Methods("DELETE")
 
-	funcRemove = func(id string) error {
+	funcRemove = func(_, id string) error {
 		if id == "ROUTE_XXXXXXXXXXXXXXXXXX" {
 			return nil
 		}
@@ -370,6 +761,36 @@ func TestRemoveRouteReturnsNoContent(t *testing.T) {
 	}
 }
 
+func TestRemoveRouteCountsTheMutation(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/routes/FOO", nil)
+	resp := httptest.NewRecorder()
+	handler := mux.NewRouter()
+	handler.HandleFunc("/routes/{id}", removeRoute).
+		Methods("DELETE")
+	funcRemove = func(_, id string) error { return nil }
+	before := routeMutations.Value("remove")
+
+	handler.ServeHTTP(resp, req)
+
+	if v := routeMutations.Value("remove") - before; v != 1 {
+		t.Errorf("Mutation count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
+func TestAddRouteCountsTheMutation(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello"}`
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcAdd = addOn([]model.Route{}, func(_ string, input model.Route) model.Route { return input })
+	before := routeMutations.Value("add")
+
+	addRoute(resp, req)
+
+	if v := routeMutations.Value("add") - before; v != 1 {
+		t.Errorf("Mutation count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
 func TestListRoutesReturnsEmptyList(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/routes/", nil)
 	resp := httptest.NewRecorder()
@@ -485,3 +906,450 @@ func TestGetRouteReturnsTheRequestedRoute(t *testing.T) {
 		t.Errorf(`Route mismatch. Expected: "FOO". Got: %s`, respJson.ID)
 	}
 }
+
+// addOn returns a funcAdd that checks the route against rs before calling
+// add, as the route list does
+func addOn(rs []model.Route, add func(string, model.Route) model.Route) func(string, model.Route, func([]model.Route) error) (model.Route, error) {
+	return func(actor string, r model.Route, check func([]model.Route) error) (model.Route, error) {
+		if err := check(rs); err != nil {
+			return model.Route{}, err
+		}
+		return add(actor, r), nil
+	}
+}
+
+// insertOn returns a funcInsert that checks the route against rs before
+// calling insert, as the route list does
+func insertOn(rs []model.Route, insert func(string, model.Route, int) model.Route) func(string, model.Route, int, func([]model.Route) error) (model.Route, error) {
+	return func(actor string, r model.Route, index int, check func([]model.Route) error) (model.Route, error) {
+		if err := check(rs); err != nil {
+			return model.Route{}, err
+		}
+		return insert(actor, r, index), nil
+	}
+}
+
+// importOn returns a funcMerge or funcReplaceAll that checks the routes
+// against rs before calling imp, as the route list does
+func importOn(rs []model.Route, imp func(string, []model.Route)) func(string, []model.Route, func([]model.Route) error) error {
+	return func(actor string, routes []model.Route, check func([]model.Route) error) error {
+		if check != nil {
+			if err := check(rs); err != nil {
+				return err
+			}
+		}
+		imp(actor, routes)
+		return nil
+	}
+}
+
+// updateOn returns a funcUpdate that changes the given route, served along
+// with rs, failing for any other ID as the route list does
+func updateOn(stored model.Route, rs []model.Route) func(string, string, func(*model.Route, []model.Route) error) (model.Route, error) {
+	return func(_, id string, update func(*model.Route, []model.Route) error) (model.Route, error) {
+		if id != stored.ID {
+			return model.Route{}, errors.New("Route not found")
+		}
+		r := stored
+		if err := update(&r, rs); err != nil {
+			return model.Route{}, err
+		}
+		r.ID, r.Index = stored.ID, stored.Index
+		return r, nil
+	}
+}
+
+func changeRouteRouter() *mux.Router {
+	handler := mux.NewRouter()
+	handler.HandleFunc("/routes/{id}", replaceRoute).
+		Methods(http.MethodPut)
+	handler.HandleFunc("/routes/{id}", updateRoute).
+		Methods(http.MethodPatch)
+	return handler
+}
+
+var storedRoute = model.Route{
+	ID:         "FOO",
+	Method:     "GET",
+	Pattern:    "/hello",
+	Entrypoint: "/bin/sh -c",
+	Command:    "echo Hello",
+	Index:      3,
+	PowFile:    "/etc/kapow/hello.pow",
+}
+
+func TestReplaceRouteAndUpdateRouteReturnBadRequestWhenMalformedJSONBody(t *testing.T) {
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		req := httptest.NewRequest(method, "/routes/FOO", strings.NewReader(`{"method": 42}`))
+		resp := httptest.NewRecorder()
+		funcUpdate = updateOn(storedRoute, []model.Route{})
+
+		changeRouteRouter().ServeHTTP(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Malformed JSON") {
+			t.Errorf("%s: %s", method, e)
+		}
+	}
+}
+
+func TestReplaceRouteAndUpdateRouteReturnNotFound(t *testing.T) {
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		req := httptest.NewRequest(method, "/routes/BAR", strings.NewReader(`{"method": "GET", "url_pattern": "/"}`))
+		resp := httptest.NewRecorder()
+		funcUpdate = updateOn(storedRoute, []model.Route{})
+
+		changeRouteRouter().ServeHTTP(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), http.StatusNotFound, "Route Not Found") {
+			t.Errorf("%s: %s", method, e)
+		}
+	}
+}
+
+func TestReplaceRoute422sWhenTheNewRouteIsIncomplete(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/routes/FOO", strings.NewReader(`{"command": "echo Bye"}`))
+	resp := httptest.NewRecorder()
+	funcUpdate = updateOn(storedRoute, []model.Route{})
+
+	changeRouteRouter().ServeHTTP(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, "Invalid Route: method is mandatory") {
+		t.Error(e)
+	}
+}
+
+func TestReplaceRouteReplacesEveryFieldButIDIndexAndPowFile(t *testing.T) {
+	reqPayload := `{"method": "POST", "url_pattern": "/bye", "command": "echo Bye", "index": 0}`
+	req := httptest.NewRequest(http.MethodPut, "/routes/FOO", strings.NewReader(reqPayload))
+	resp := httptest.NewRecorder()
+	funcUpdate = updateOn(storedRoute, []model.Route{})
+
+	changeRouteRouter().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	respJson := model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil {
+		t.Fatalf("Invalid JSON response. %s", resp.Body.String())
+	}
+	expected := model.Route{ID: "FOO", Method: "POST", Pattern: "/bye", Command: "echo Bye", Index: 3, PowFile: "/etc/kapow/hello.pow"}
+	if respJson != expected {
+		t.Errorf("Response mismatch. Expected %#v, got: %#v", expected, respJson)
+	}
+}
+
+func TestReplaceRouteAndUpdateRoute422sWhenTheIDsDontMatch(t *testing.T) {
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		req := httptest.NewRequest(method, "/routes/FOO", strings.NewReader(`{"id": "BAR", "method": "GET", "url_pattern": "/"}`))
+		resp := httptest.NewRecorder()
+		funcUpdate = updateOn(storedRoute, []model.Route{})
+
+		changeRouteRouter().ServeHTTP(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, `Invalid Route: route id "BAR" doesn't match the id in the URL "FOO"`) {
+			t.Errorf("%s: %s", method, e)
+		}
+	}
+}
+
+func TestUpdateRouteChangesOnlyTheGivenFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/routes/FOO", strings.NewReader(`{"command": "echo Bye"}`))
+	resp := httptest.NewRecorder()
+	funcUpdate = updateOn(storedRoute, []model.Route{})
+
+	changeRouteRouter().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Incorrect content type in response. Expected: application/json, got: %s", ct)
+	}
+	respJson := model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil {
+		t.Fatalf("Invalid JSON response. %s", resp.Body.String())
+	}
+	expected := storedRoute
+	expected.Command = "echo Bye"
+	if respJson != expected {
+		t.Errorf("Response mismatch. Expected %#v, got: %#v", expected, respJson)
+	}
+}
+
+func TestUpdateRouteDoesntClashWithItself(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/routes/FOO", strings.NewReader(`{"command": "echo Bye"}`))
+	resp := httptest.NewRecorder()
+	funcUpdate = updateOn(storedRoute, []model.Route{storedRoute})
+
+	changeRouteRouter().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+}
+
+func TestUpdateRoute422sWhenTheResultIsDuplicated(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/routes/FOO", strings.NewReader(`{"url_pattern": "/bye"}`))
+	resp := httptest.NewRecorder()
+	funcUpdate = updateOn(storedRoute, []model.Route{storedRoute, {ID: "BAR", Method: "GET", Pattern: "/bye"}})
+
+	changeRouteRouter().ServeHTTP(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, `Invalid Route: duplicated route GET /bye, already in route "BAR"`) {
+		t.Error(e)
+	}
+}
+
+func TestUpdateRoute422sWhenTheResultIsInvalid(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/routes/FOO", strings.NewReader(`{"url_pattern": ""}`))
+	resp := httptest.NewRecorder()
+	funcUpdate = updateOn(storedRoute, []model.Route{})
+
+	changeRouteRouter().ServeHTTP(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, "Invalid Route: url_pattern is mandatory") {
+		t.Error(e)
+	}
+}
+
+func TestReplaceRouteAndUpdateRouteCountTheMutation(t *testing.T) {
+	for method, operation := range map[string]string{http.MethodPut: "replace", http.MethodPatch: "update"} {
+		req := httptest.NewRequest(method, "/routes/FOO", strings.NewReader(`{"method": "GET", "url_pattern": "/"}`))
+		resp := httptest.NewRecorder()
+		funcUpdate = updateOn(storedRoute, []model.Route{})
+		before := routeMutations.Value(operation)
+
+		changeRouteRouter().ServeHTTP(resp, req)
+
+		if v := routeMutations.Value(operation) - before; v != 1 {
+			t.Errorf("%s: Mutation count mismatch. Expected: 1. Got: %v", method, v)
+		}
+	}
+}
+
+func TestListRoutesReturnsAPowFileWhenRequested(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?format=pow", nil)
+	resp := httptest.NewRecorder()
+	funcList = func() []model.Route {
+		return []model.Route{{Method: "GET", Pattern: "/hello", Entrypoint: "/bin/sh -c", Command: "echo 'Hello'"}}
+	}
+
+	listRoutes(resp, req)
+
+	if ct := resp.Header().Get("Content-Type"); ct != "text/x-shellscript; charset=utf-8" {
+		t.Errorf("Incorrect content type in response. Got: %s", ct)
+	}
+	expected := `#!/bin/sh
+kapow route add -X 'GET' -e '/bin/sh -c' -c 'echo '\''Hello'\''' '/hello'
+`
+	if resp.Body.String() != expected {
+		t.Errorf("Pow file mismatch. Expected: %q. Got: %q", expected, resp.Body.String())
+	}
+}
+
+func TestListRoutes400sOnUnknownFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?format=xml", nil)
+	resp := httptest.NewRecorder()
+	funcList = func() []model.Route { return []model.Route{} }
+
+	listRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Invalid Format") {
+		t.Error(e)
+	}
+}
+
+func TestImportRoutes400sOnUnknownMode(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:import?mode=append", strings.NewReader(`[]`))
+	resp := httptest.NewRecorder()
+
+	importRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Invalid Mode") {
+		t.Error(e)
+	}
+}
+
+func TestImportRoutesReturnsBadRequestWhenMalformedJSONBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:import", strings.NewReader(`{"method": "GET"}`))
+	resp := httptest.NewRecorder()
+
+	importRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Malformed JSON") {
+		t.Error(e)
+	}
+}
+
+func TestImportRoutesImportsNothingWhenARouteIsInvalid(t *testing.T) {
+	testCases := map[string]struct{ payload, reason string }{
+		"invalid route": {
+			`[{"method": "GET", "url_pattern": "/foo"}, {"method": "GET"}]`,
+			"Invalid Route: url_pattern is mandatory",
+		},
+		"duplicated id": {
+			`[{"id": "FOO", "method": "GET", "url_pattern": "/foo"}, {"id": "FOO", "method": "GET", "url_pattern": "/bar"}]`,
+			`Invalid Route: duplicated route id "FOO"`,
+		},
+		"duplicated route": {
+			`[{"id": "FOO", "method": "GET", "url_pattern": "/foo"}, {"id": "BAR", "method": "GET", "url_pattern": "/foo"}]`,
+			`Invalid Route: duplicated route GET /foo, already in route "FOO"`,
+		},
+		"clashing with a kept route": {
+			`[{"id": "BAR", "method": "GET", "url_pattern": "/baz"}]`,
+			`Invalid Route: duplicated route GET /baz, already in route "BAZ"`,
+		},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/routes:import", strings.NewReader(tc.payload))
+		resp := httptest.NewRecorder()
+		funcMerge = importOn([]model.Route{{ID: "BAZ", Method: "GET", Pattern: "/baz"}}, func(string, []model.Route) { t.Errorf("%s: Routes imported", name) })
+
+		importRoutes(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, tc.reason) {
+			t.Errorf("%s: %s", name, e)
+		}
+	}
+}
+
+func TestImportRoutesMergesByDefaultKeepingGivenIDs(t *testing.T) {
+	payload := `[{"id": "FOO", "method": "GET", "url_pattern": "/foo"}, {"method": "GET", "url_pattern": "/bar"}]`
+	req := httptest.NewRequest(http.MethodPost, "/routes:import", strings.NewReader(payload))
+	resp := httptest.NewRecorder()
+	var merged []model.Route
+	funcMerge = importOn([]model.Route{}, func(_ string, rs []model.Route) { merged = rs })
+	funcReplaceAll = importOn([]model.Route{}, func(string, []model.Route) { t.Error("Routes replaced") })
+	funcList = func() []model.Route { return merged }
+
+	importRoutes(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	if len(merged) != 2 || merged[0].ID != "FOO" || merged[1].ID == "" {
+		t.Errorf("Unexpected merged routes: %v", merged)
+	}
+	respJson := []model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil || !reflect.DeepEqual(respJson, merged) {
+		t.Errorf("Response mismatch. Got: %s", resp.Body.String())
+	}
+}
+
+func TestImportRoutesReplacesTheRoutesInReplaceMode(t *testing.T) {
+	payload := `[{"id": "FOO", "method": "GET", "url_pattern": "/foo"}]`
+	req := httptest.NewRequest(http.MethodPost, "/routes:import?mode=replace", strings.NewReader(payload))
+	resp := httptest.NewRecorder()
+	var replaced []model.Route
+	funcReplaceAll = importOn([]model.Route{}, func(_ string, rs []model.Route) { replaced = rs })
+	funcMerge = importOn([]model.Route{}, func(string, []model.Route) { t.Error("Routes merged") })
+	funcList = func() []model.Route { return replaced }
+	before := routeMutations.Value("import")
+
+	importRoutes(resp, req)
+
+	if len(replaced) != 1 || replaced[0].ID != "FOO" {
+		t.Errorf("Unexpected replacing routes: %v", replaced)
+	}
+	if v := routeMutations.Value("import") - before; v != 1 {
+		t.Errorf("Mutation count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
+func TestGetHistoryReturnsTheRevisions(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes/history", nil)
+	resp := httptest.NewRecorder()
+	revisions := []user.Revision{
+		{Version: 1, Operation: "append", Actor: "alice", Before: []model.Route{}, After: []model.Route{{ID: "FOO"}}},
+	}
+	funcHistory = func() []user.Revision { return revisions }
+
+	getHistory(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	if v := resp.Header().Get("Content-Type"); v != "application/json" {
+		t.Errorf("Content-Type header mismatch. Expected: %q, got: %q", "application/json", v)
+	}
+	respJson := []user.Revision{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil || !reflect.DeepEqual(respJson, revisions) {
+		t.Errorf("Response mismatch. Got: %s", resp.Body.String())
+	}
+}
+
+func TestRollbackRoutesReturnsBadRequestOnInvalidVersion(t *testing.T) {
+	for _, query := range []string{"", "?version=", "?version=foo", "?version=0", "?version=-1"} {
+		req := httptest.NewRequest(http.MethodPost, "/routes/rollback"+query, nil)
+		resp := httptest.NewRecorder()
+		funcRollback = func(string, int) error { t.Errorf("%q: Routes rolled back", query); return nil }
+
+		rollbackRoutes(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Invalid Version") {
+			t.Errorf("%q: %s", query, e)
+		}
+	}
+}
+
+func TestRollbackRoutesReturnsNotFoundOnUnknownVersion(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes/rollback?version=42", nil)
+	resp := httptest.NewRecorder()
+	funcRollback = func(string, int) error { return errors.New("Version not found") }
+
+	rollbackRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusNotFound, "Version Not Found") {
+		t.Error(e)
+	}
+}
+
+func TestRollbackRoutesRestoresTheVersionAndReturnsTheRoutes(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes/rollback?version=3", nil)
+	req = req.WithContext(context.WithValue(req.Context(), actorKey{}, "alice"))
+	resp := httptest.NewRecorder()
+	var gotActor string
+	var gotVersion int
+	funcRollback = func(actor string, version int) error {
+		gotActor, gotVersion = actor, version
+		return nil
+	}
+	funcList = func() []model.Route { return []model.Route{{ID: "FOO"}} }
+	before := routeMutations.Value("rollback")
+
+	rollbackRoutes(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	if gotActor != "alice" || gotVersion != 3 {
+		t.Errorf("Unexpected rollback. Actor: %q. Version: %d", gotActor, gotVersion)
+	}
+	respJson := []model.Route{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &respJson); err != nil || len(respJson) != 1 || respJson[0].ID != "FOO" {
+		t.Errorf("Response mismatch. Got: %s", resp.Body.String())
+	}
+	if v := routeMutations.Value("rollback") - before; v != 1 {
+		t.Errorf("Mutation count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
+func TestAddRouteRecordsTheActor(t *testing.T) {
+	reqPayload := `{"method": "GET", "url_pattern": "/hello", "entrypoint": "", "command": ""}`
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(reqPayload))
+	req = req.WithContext(context.WithValue(req.Context(), actorKey{}, "alice"))
+	resp := httptest.NewRecorder()
+	var gotActor string
+	funcAdd = addOn(nil, func(actor string, input model.Route) model.Route {
+		gotActor = actor
+		return input
+	})
+	funcList = func() []model.Route { return []model.Route{} }
+
+	addRoute(resp, req)
+
+	if gotActor != "alice" {
+		t.Errorf("Actor mismatch. Expected: %q. Got: %q", "alice", gotActor)
+	}
+}
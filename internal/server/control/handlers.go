@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/BBVA/kapow/internal/server/data"
+	"github.com/BBVA/kapow/internal/server/httperror"
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/user/spawn"
+)
+
+// handlerInfo is the summary of a handler of a user request in flight
+type handlerInfo struct {
+	ID         string    `json:"id"`
+	RouteID    string    `json:"route_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	RemoteAddr string    `json:"remote_addr"`
+	Started    time.Time `json:"started"`
+	PID        int       `json:"pid"`
+}
+
+// handlerDetail is the summary of a handler along with its whole route
+type handlerDetail struct {
+	handlerInfo
+	Route model.Route `json:"route"`
+}
+
+func newHandlerInfo(h *model.Handler) handlerInfo {
+	return handlerInfo{
+		ID:         h.ID,
+		RouteID:    h.Route.ID,
+		Method:     h.Request.Method,
+		Path:       h.Request.RequestURI,
+		RemoteAddr: h.Request.RemoteAddr,
+		Started:    h.Started,
+		PID:        h.PID(),
+	}
+}
+
+// funcHandlerIDs Method used to ask the data module for the ids of the
+// handlers in flight
+var funcHandlerIDs func() []string = data.Handlers.ListIDs
+
+// funcGetHandler Method used to ask the data module for a handler in flight
+var funcGetHandler func(string) (*model.Handler, bool) = data.Handlers.Get
+
+// funcCancelHandler Method used to kill the processes spawned for a handler
+var funcCancelHandler func(*model.Handler) error = spawn.Cancel
+
+// listHandlers Handler that retrieves the handlers of the user requests in
+// flight, oldest first
+func listHandlers(res http.ResponseWriter, req *http.Request) {
+	list := []handlerInfo{}
+	for _, id := range funcHandlerIDs() {
+		// The handler may have finished meanwhile
+		if h, ok := funcGetHandler(id); ok {
+			list = append(list, newHandlerInfo(h))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Started.Equal(list[j].Started) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Started.Before(list[j].Started)
+	})
+
+	listBytes, _ := json.Marshal(list)
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(listBytes)
+}
+
+// getHandler Handler that retrieves the details of a handler in flight. If
+// it doesn't exist returns 404 and an error entity
+func getHandler(res http.ResponseWriter, req *http.Request) {
+	h, ok := funcGetHandler(mux.Vars(req)["id"])
+	if !ok {
+		httperror.ErrorJSON(res, "Handler Not Found", http.StatusNotFound)
+		return
+	}
+
+	hBytes, _ := json.Marshal(handlerDetail{handlerInfo: newHandlerInfo(h), Route: h.Route})
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(hBytes)
+}
+
+// cancelHandler Handler that kills the process group spawned for a handler
+// in flight and aborts the connection of its client.  If it doesn't exist
+// returns 404 and an error entity
+func cancelHandler(res http.ResponseWriter, req *http.Request) {
+	h, ok := funcGetHandler(mux.Vars(req)["id"])
+	if !ok {
+		httperror.ErrorJSON(res, "Handler Not Found", http.StatusNotFound)
+		return
+	}
+
+	if err := funcCancelHandler(h); err != nil {
+		log.Printf("Cancelling handler %s failed: %s", h.ID, err)
+		httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
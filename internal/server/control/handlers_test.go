@@ -0,0 +1,187 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func handlersRouter() *mux.Router {
+	handler := mux.NewRouter()
+	handler.HandleFunc("/handlers/{id}", getHandler).
+		Methods(http.MethodGet)
+	handler.HandleFunc("/handlers/{id}", cancelHandler).
+		Methods(http.MethodDelete)
+	return handler
+}
+
+// storedHandlers makes the handler functions work on hs
+func storedHandlers(hs ...*model.Handler) {
+	funcHandlerIDs = func() []string {
+		ids := []string{}
+		for _, h := range hs {
+			ids = append(ids, h.ID)
+		}
+		return append(ids, "FINISHED")
+	}
+	funcGetHandler = func(id string) (*model.Handler, bool) {
+		for _, h := range hs {
+			if h.ID == id {
+				return h, true
+			}
+		}
+		return nil, false
+	}
+}
+
+func newTestHandler(id string, started time.Time) *model.Handler {
+	req := httptest.NewRequest(http.MethodGet, "/hello?name=foo", nil)
+	req.RemoteAddr = "127.0.0.1:4242"
+	return &model.Handler{
+		ID:      id,
+		Route:   model.Route{ID: "ROUTE", Method: "GET", Pattern: "/hello"},
+		Request: req,
+		Started: started,
+	}
+}
+
+func TestListHandlersReturnsEmptyListWithoutHandlers(t *testing.T) {
+	resp := httptest.NewRecorder()
+	funcHandlerIDs = func() []string { return nil }
+
+	listHandlers(resp, httptest.NewRequest(http.MethodGet, "/handlers", nil))
+
+	if resp.Body.String() != "[]" {
+		t.Errorf("Unexpected body: %q", resp.Body.String())
+	}
+}
+
+func TestListHandlersReturnsTheHandlersOldestFirst(t *testing.T) {
+	now := time.Now().Round(0)
+	storedHandlers(newTestHandler("NEW", now), newTestHandler("OLD", now.Add(-time.Minute)))
+	resp := httptest.NewRecorder()
+
+	listHandlers(resp, httptest.NewRequest(http.MethodGet, "/handlers", nil))
+
+	if v := resp.Header().Get("Content-Type"); v != "application/json" {
+		t.Errorf("Content-Type header mismatch. Expected: %q, got: %q", "application/json", v)
+	}
+	var list []handlerInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("Unexpected body: %s", resp.Body.String())
+	}
+	if list[0].ID != "OLD" || list[1].ID != "NEW" {
+		t.Errorf("Unexpected order: %v", list)
+	}
+	expected := handlerInfo{
+		ID:         "NEW",
+		RouteID:    "ROUTE",
+		Method:     "GET",
+		Path:       "/hello?name=foo",
+		RemoteAddr: "127.0.0.1:4242",
+		Started:    now,
+	}
+	if !list[1].Started.Equal(now) {
+		t.Errorf("Start time mismatch. Expected: %v. Got: %v", now, list[1].Started)
+	}
+	list[1].Started = now
+	if list[1] != expected {
+		t.Errorf("Handler mismatch. Expected: %v. Got: %v", expected, list[1])
+	}
+}
+
+func TestGetHandlerReturnsNotFoundWhenTheHandlerDoesntExist(t *testing.T) {
+	storedHandlers()
+	resp := httptest.NewRecorder()
+
+	handlersRouter().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/handlers/FOO", nil))
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusNotFound, "Handler Not Found") {
+		t.Error(e)
+	}
+}
+
+func TestGetHandlerReturnsTheHandlerWithItsRoute(t *testing.T) {
+	storedHandlers(newTestHandler("FOO", time.Now()))
+	resp := httptest.NewRecorder()
+
+	handlersRouter().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/handlers/FOO", nil))
+
+	var detail handlerDetail
+	if err := json.Unmarshal(resp.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("Unexpected body: %s", resp.Body.String())
+	}
+	if detail.ID != "FOO" || detail.RouteID != "ROUTE" || detail.Route.Pattern != "/hello" {
+		t.Errorf("Unexpected handler: %v", detail)
+	}
+}
+
+func TestCancelHandlerReturnsNotFoundWhenTheHandlerDoesntExist(t *testing.T) {
+	storedHandlers()
+	funcCancelHandler = func(*model.Handler) error {
+		t.Error("Handler cancelled")
+		return nil
+	}
+	resp := httptest.NewRecorder()
+
+	handlersRouter().ServeHTTP(resp, httptest.NewRequest(http.MethodDelete, "/handlers/FOO", nil))
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusNotFound, "Handler Not Found") {
+		t.Error(e)
+	}
+}
+
+func TestCancelHandlerCancelsTheHandler(t *testing.T) {
+	h := newTestHandler("FOO", time.Now())
+	storedHandlers(h)
+	var cancelled *model.Handler
+	funcCancelHandler = func(h *model.Handler) error {
+		cancelled = h
+		return nil
+	}
+	resp := httptest.NewRecorder()
+
+	handlersRouter().ServeHTTP(resp, httptest.NewRequest(http.MethodDelete, "/handlers/FOO", nil))
+
+	if resp.Code != http.StatusNoContent {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusNoContent, resp.Code)
+	}
+	if cancelled != h {
+		t.Error("Handler not cancelled")
+	}
+}
+
+func TestCancelHandlerReturnsInternalServerErrorWhenTheKillFails(t *testing.T) {
+	storedHandlers(newTestHandler("FOO", time.Now()))
+	funcCancelHandler = func(*model.Handler) error { return errors.New("operation not permitted") }
+	resp := httptest.NewRecorder()
+
+	handlersRouter().ServeHTTP(resp, httptest.NewRequest(http.MethodDelete, "/handlers/FOO", nil))
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusInternalServerError, "Internal Server Error") {
+		t.Error(e)
+	}
+}
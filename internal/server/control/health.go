@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+
+	"github.com/BBVA/kapow/internal/server/data"
+	"github.com/BBVA/kapow/internal/server/metrics"
+	"github.com/BBVA/kapow/internal/server/user"
+)
+
+// HealthServer is a singleton that stores the http.Server for the health
+// and metrics endpoints when they have a dedicated bind address
+var HealthServer = http.Server{Handler: healthRouter()}
+
+// ready is non-zero while the server is ready to handle user requests
+var ready int32
+
+// SetReady sets whether the server is ready to handle user requests.  The
+// server becomes ready once every pow file has run and stops being so as
+// soon as it starts draining on shutdown.
+func SetReady(r bool) {
+	var v int32
+	if r {
+		v = 1
+	}
+	atomic.StoreInt32(&ready, v)
+}
+
+// isReady tells whether the server is ready to handle user requests
+func isReady() bool {
+	return atomic.LoadInt32(&ready) != 0
+}
+
+// healthStatus is the entity returned by the health endpoints
+type healthStatus struct {
+	Status   string `json:"status"`
+	Routes   int    `json:"routes"`
+	Handlers int    `json:"handlers"`
+}
+
+// funcRouteCount Method used to ask the route model module for the number
+// of routes
+var funcRouteCount func() int = user.Routes.Len
+
+// funcHandlerCount Method used to ask the handler model module for the
+// number of in-flight handlers
+var funcHandlerCount func() int = data.Handlers.Len
+
+// addHealthRoutes Adds the liveness, readiness and metrics endpoints to r
+func addHealthRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", healthz).
+		Methods(http.MethodGet)
+	r.HandleFunc("/readyz", readyz).
+		Methods(http.MethodGet)
+	r.HandleFunc("/metrics", metrics.Handler).
+		Methods(http.MethodGet)
+}
+
+// healthRouter Builds a mux exposing only the health and metrics endpoints
+func healthRouter() *mux.Router {
+	r := mux.NewRouter()
+	addHealthRoutes(r)
+	return r
+}
+
+// healthz Handler that reports that the server is alive.  It always
+// returns 200 while the control server is able to answer.
+func healthz(res http.ResponseWriter, req *http.Request) {
+	writeHealth(res, "ok", http.StatusOK)
+}
+
+// readyz Handler that reports whether the server is ready to handle user
+// requests.  Returns 503 until every pow file has run and while draining.
+func readyz(res http.ResponseWriter, req *http.Request) {
+	if isReady() {
+		writeHealth(res, "ready", http.StatusOK)
+	} else {
+		writeHealth(res, "not ready", http.StatusServiceUnavailable)
+	}
+}
+
+func writeHealth(res http.ResponseWriter, status string, code int) {
+	body, _ := json.Marshal(healthStatus{
+		Status:   status,
+		Routes:   funcRouteCount(),
+		Handlers: funcHandlerCount(),
+	})
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	_, _ = res.Write(body)
+}
+
+// RunHealth Starts HealthServer accepting connections from l
+//
+// It returns nil when the server is shut down.
+func RunHealth(l net.Listener) error {
+	if err := HealthServer.Serve(l); err != http.ErrServerClosed {
+		return fmt.Errorf("HealthServer failed: %s", err)
+	}
+	return nil
+}
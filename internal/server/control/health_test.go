@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func fakeCounts(routes, handlers int) func() {
+	origRouteCount, origHandlerCount := funcRouteCount, funcHandlerCount
+	funcRouteCount = func() int { return routes }
+	funcHandlerCount = func() int { return handlers }
+	return func() {
+		funcRouteCount, funcHandlerCount = origRouteCount, origHandlerCount
+	}
+}
+
+func checkHealthResponse(t *testing.T, resp *httptest.ResponseRecorder, code int, expected healthStatus) {
+	if resp.Code != code {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", code, resp.Code)
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Incorrect content type in response. Expected: application/json, got: %q", ct)
+	}
+	var got healthStatus
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON response. %s", resp.Body.String())
+	}
+	if got != expected {
+		t.Errorf("Response mismatch. Expected: %+v, got: %+v", expected, got)
+	}
+}
+
+func TestHealthzReportsOKAndTheCounts(t *testing.T) {
+	defer fakeCounts(3, 2)()
+	resp := httptest.NewRecorder()
+
+	healthz(resp, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	checkHealthResponse(t, resp, http.StatusOK, healthStatus{Status: "ok", Routes: 3, Handlers: 2})
+}
+
+func TestHealthzReportsOKWhenNotReady(t *testing.T) {
+	defer fakeCounts(0, 0)()
+	SetReady(false)
+	resp := httptest.NewRecorder()
+
+	healthz(resp, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	checkHealthResponse(t, resp, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+func TestReadyzReports503UntilReady(t *testing.T) {
+	defer fakeCounts(1, 0)()
+	SetReady(false)
+	resp := httptest.NewRecorder()
+
+	readyz(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	checkHealthResponse(t, resp, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Routes: 1})
+}
+
+func TestReadyzReportsReadyAndTheCounts(t *testing.T) {
+	defer fakeCounts(4, 1)()
+	SetReady(true)
+	defer SetReady(false)
+	resp := httptest.NewRecorder()
+
+	readyz(resp, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	checkHealthResponse(t, resp, http.StatusOK, healthStatus{Status: "ready", Routes: 4, Handlers: 1})
+}
+
+func TestRunHealthServesOnlyTheHealthEndpoints(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- RunHealth(l) }()
+	base := "http://" + l.Addr().String()
+
+	if resp, err := http.Get(base + "/healthz"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp, err := http.Get(base + "/routes"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	_ = HealthServer.Close()
+	if err := <-errc; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/BBVA/kapow/internal/server/httperror"
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/user"
+)
+
+// matchRequest is the request to be matched against the routes
+type matchRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// matchResult is the route that would serve a request, along with the
+// variables taken from the request path
+type matchResult struct {
+	Route   model.Route       `json:"route"`
+	Index   int               `json:"index"`
+	Matches map[string]string `json:"matches"`
+}
+
+// funcMatch Method used to ask the route model module for the route that
+// would serve a request
+var funcMatch func(*http.Request) (model.Route, map[string]string, bool) = user.Routes.Match
+
+// matchRoute Handler that tells which route would serve the given request,
+// without running anything.  Returns 404 if no route matches it.
+func matchRoute(res http.ResponseWriter, req *http.Request) {
+	var mr matchRequest
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(payload, &mr); err != nil {
+		httperror.ErrorJSON(res, "Malformed JSON", http.StatusBadRequest)
+		return
+	}
+
+	if mr.Method == "" {
+		httperror.ErrorJSON(res, "Invalid Request: method is mandatory", http.StatusUnprocessableEntity)
+		return
+	}
+	if mr.URL == "" {
+		httperror.ErrorJSON(res, "Invalid Request: url is mandatory", http.StatusUnprocessableEntity)
+		return
+	}
+	r, err := http.NewRequest(mr.Method, mr.URL, nil)
+	if err != nil {
+		httperror.ErrorJSON(res, "Invalid Request: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	for k, v := range mr.Headers {
+		r.Header.Set(k, v)
+	}
+
+	route, vars, ok := funcMatch(r)
+	if !ok {
+		httperror.ErrorJSON(res, "No Match", http.StatusNotFound)
+		return
+	}
+
+	resultBytes, _ := json.Marshal(matchResult{Route: route, Index: route.Index, Matches: vars})
+	res.Header().Set("Content-Type", "application/json")
+	_, _ = res.Write(resultBytes)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestMatchRouteReturnsBadRequestWhenMalformedJSONBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:match", strings.NewReader(`{"method"`))
+	resp := httptest.NewRecorder()
+
+	matchRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Malformed JSON") {
+		t.Error(e)
+	}
+}
+
+func TestMatchRouteReturnsUnprocessableEntityOnInvalidRequest(t *testing.T) {
+	testCases := []struct {
+		payload, reason string
+	}{
+		{`{"url": "/foo"}`, "Invalid Request: method is mandatory"},
+		{`{"method": "GET"}`, "Invalid Request: url is mandatory"},
+		{`{"method": "G ET", "url": "/foo"}`, `Invalid Request: net/http: invalid method "G ET"`},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/routes:match", strings.NewReader(tc.payload))
+		resp := httptest.NewRecorder()
+		funcMatch = func(*http.Request) (model.Route, map[string]string, bool) {
+			t.Errorf("%s: Request matched", tc.payload)
+			return model.Route{}, nil, false
+		}
+
+		matchRoute(resp, req)
+
+		for _, e := range checkErrorResponse(resp.Result(), http.StatusUnprocessableEntity, tc.reason) {
+			t.Errorf("%s: %s", tc.payload, e)
+		}
+	}
+}
+
+func TestMatchRouteReturnsNotFoundWhenNoRouteMatches(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/routes:match", strings.NewReader(`{"method": "GET", "url": "/foo"}`))
+	resp := httptest.NewRecorder()
+	funcMatch = func(*http.Request) (model.Route, map[string]string, bool) { return model.Route{}, nil, false }
+
+	matchRoute(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusNotFound, "No Match") {
+		t.Error(e)
+	}
+}
+
+func TestMatchRouteMatchesTheGivenRequest(t *testing.T) {
+	payload := `{"method": "POST", "url": "http://example.com/foo/bar?q=1", "headers": {"X-Foo": "bar"}}`
+	req := httptest.NewRequest(http.MethodPost, "/routes:match", strings.NewReader(payload))
+	resp := httptest.NewRecorder()
+	var matched *http.Request
+	funcMatch = func(r *http.Request) (model.Route, map[string]string, bool) {
+		matched = r
+		return model.Route{ID: "FOO", Index: 2}, map[string]string{"name": "bar"}, true
+	}
+
+	matchRoute(resp, req)
+
+	if matched.Method != "POST" || matched.URL.Path != "/foo/bar" || matched.Host != "example.com" || matched.Header.Get("X-Foo") != "bar" {
+		t.Errorf("Unexpected request matched: %v", matched)
+	}
+	if resp.Code != http.StatusOK {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	if v := resp.Header().Get("Content-Type"); v != "application/json" {
+		t.Errorf("Content-Type header mismatch. Expected: %q, got: %q", "application/json", v)
+	}
+	var result matchResult
+	expected := matchResult{Route: model.Route{ID: "FOO", Index: 2}, Index: 2, Matches: map[string]string{"name": "bar"}}
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("Response mismatch. Got: %s", resp.Body.String())
+	}
+}
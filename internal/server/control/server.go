@@ -17,11 +17,27 @@
 package control
 
 import (
-	"log"
+	"fmt"
+	"net"
 	"net/http"
 )
 
-// Run Starts the control server listening in bindAddr
-func Run(bindAddr string) {
-	log.Fatal(http.ListenAndServe(bindAddr, configRouter()))
+// Server is a singleton that stores the http.Server for the control package.
+// Requests must carry a bearer token when tokens have been set with
+// SetTokens.  The running watches of the route list end when the server is
+// shut down.
+var Server = http.Server{Handler: authenticate(configRouter())}
+
+func init() {
+	Server.RegisterOnShutdown(stopWatches)
+}
+
+// Run Starts the control server accepting connections from l
+//
+// It returns nil when the server is shut down.
+func Run(l net.Listener) error {
+	if err := Server.Serve(l); err != http.ErrServerClosed {
+		return fmt.Errorf("ControlServer failed: %s", err)
+	}
+	return nil
 }
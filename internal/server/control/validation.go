@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// validID Matches the ids a route can be given: letters, digits, dots,
+// underscores and hyphens, starting with a letter or a digit, so they can be
+// used as is in the URLs of the control API
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// reservedIDs Are the ids that clash with the other endpoints under /routes/
+var reservedIDs = map[string]bool{"history": true, "rollback": true}
+
+// ValidateID Checks that id can be given to a route.  An empty id is valid,
+// as a new one is generated for the route.
+func ValidateID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid id %q: only letters, digits, '.', '_' and '-' are allowed, starting with a letter or a digit, up to 128 characters", id)
+	}
+	if reservedIDs[id] {
+		return fmt.Errorf("invalid id %q: reserved", id)
+	}
+	return nil
+}
+
+// errIDInUse is returned, wrapped, when a route is added with the id of
+// another one
+var errIDInUse = errors.New("already in use")
+
+// CheckID Returns an error wrapping errIDInUse if any of routes already has
+// the id of route
+func CheckID(route model.Route, routes []model.Route) error {
+	if route.ID == "" {
+		return nil
+	}
+	for _, r := range routes {
+		if r.ID == route.ID {
+			return fmt.Errorf("id %q %w", route.ID, errIDInUse)
+		}
+	}
+	return nil
+}
+
+// CheckDuplicate Returns an error if any of routes, other than route itself,
+// has the same method and url_pattern as route, as the later of them could
+// never be matched
+func CheckDuplicate(route model.Route, routes []model.Route) error {
+	for _, r := range routes {
+		if r.ID != "" && r.ID == route.ID {
+			continue
+		}
+		if r.Method == route.Method && r.Pattern == route.Pattern {
+			if r.ID == "" {
+				return fmt.Errorf("duplicated route %s %s", route.Method, route.Pattern)
+			}
+			return fmt.Errorf("duplicated route %s %s, already in route %q", route.Method, route.Pattern, r.ID)
+		}
+	}
+	return nil
+}
+
+// checkClashes Returns an error if a new route has the id, or the method and
+// url_pattern, of any of routes.  The id is checked first, so a route with
+// the id in use is not mistaken for the route itself.
+func checkClashes(route model.Route, routes []model.Route) error {
+	if err := CheckID(route, routes); err != nil {
+		return err
+	}
+	return CheckDuplicate(route, routes)
+}
+
+// shadowWarnings is set when the routes shadowed by an earlier one must be
+// reported
+var shadowWarnings int32
+
+// SetShadowWarnings Enables or disables the warnings about new routes that
+// are shadowed by an earlier one
+func SetShadowWarnings(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&shadowWarnings, v)
+}
+
+// shadowingRoute Returns the first of earlier routes that matches every
+// request route would.  This is a conservative guess: a route shadows
+// another one with the same method when it matches its url_pattern as
+// written, as a catch-all such as /{path} does.
+func shadowingRoute(route model.Route, earlier []model.Route) (model.Route, bool) {
+	req, err := http.NewRequest(route.Method, "", nil)
+	if err != nil {
+		return model.Route{}, false
+	}
+	req.URL.Path = route.Pattern
+
+	for _, r := range earlier {
+		if r.Method != route.Method {
+			continue
+		}
+		m := mux.NewRouter().NewRoute().Path(r.Pattern)
+		if m.GetError() == nil && m.Match(req, &mux.RouteMatch{}) {
+			return r, true
+		}
+	}
+	return model.Route{}, false
+}
+
+// warnIfShadowed Adds a Warning header to the response, when enabled, if
+// route is shadowed by any of the earlier routes
+func warnIfShadowed(res http.ResponseWriter, route model.Route, earlier []model.Route) {
+	if atomic.LoadInt32(&shadowWarnings) == 0 {
+		return
+	}
+	if r, ok := shadowingRoute(route, earlier); ok {
+		res.Header().Add("Warning", fmt.Sprintf(`199 kapow "route shadowed by route %s (%s %s)"`, r.ID, r.Method, r.Pattern))
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestCheckDuplicateFailsOnSameMethodAndPattern(t *testing.T) {
+	routes := []model.Route{
+		{ID: "FOO", Method: "GET", Pattern: "/foo"},
+		{ID: "BAR", Method: "POST", Pattern: "/bar"},
+	}
+
+	err := CheckDuplicate(model.Route{Method: "POST", Pattern: "/bar"}, routes)
+
+	if err == nil || err.Error() != `duplicated route POST /bar, already in route "BAR"` {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckDuplicateAcceptsADifferentMethodOrPattern(t *testing.T) {
+	routes := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+
+	for _, r := range []model.Route{{Method: "POST", Pattern: "/foo"}, {Method: "GET", Pattern: "/bar"}} {
+		if err := CheckDuplicate(r, routes); err != nil {
+			t.Errorf("Unexpected error for %v: %v", r, err)
+		}
+	}
+}
+
+func TestCheckDuplicateSkipsTheRouteItself(t *testing.T) {
+	routes := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+
+	if err := CheckDuplicate(model.Route{ID: "FOO", Method: "GET", Pattern: "/foo"}, routes); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckDuplicateFailsOnTheRoutesOfTheSamePowFile(t *testing.T) {
+	routes := []model.Route{{ID: "BAR", Method: "GET", Pattern: "/bar", PowFile: "/etc/kapow/bar.pow"}}
+
+	if err := CheckDuplicate(model.Route{Method: "GET", Pattern: "/bar", PowFile: "/etc/kapow/bar.pow"}, routes); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestValidateIDAcceptsEmptyAndWellFormedIDs(t *testing.T) {
+	for _, id := range []string{"", "hello", "Hello-World_2.0", "1", "6ba7b810-9dad-41d1-80b4-00c04fd430c8"} {
+		if err := ValidateID(id); err != nil {
+			t.Errorf("Unexpected error for %q: %v", id, err)
+		}
+	}
+}
+
+func TestValidateIDRejectsMalformedAndReservedIDs(t *testing.T) {
+	for _, id := range []string{"hello world", "hello/world", "routes:batch", "-hello", ".", "..", "héllo", strings.Repeat("a", 129), "history", "rollback"} {
+		if err := ValidateID(id); err == nil {
+			t.Errorf("Expected error not returned for %q", id)
+		}
+	}
+}
+
+func TestCheckIDFailsWhenTheIDIsInUse(t *testing.T) {
+	routes := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+
+	err := CheckID(model.Route{ID: "FOO", Method: "POST", Pattern: "/bar"}, routes)
+
+	if !errors.Is(err, errIDInUse) || err.Error() != `id "FOO" already in use` {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCheckIDSkipsNewAndUnusedIDs(t *testing.T) {
+	routes := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+
+	for _, r := range []model.Route{{Method: "GET", Pattern: "/baz"}, {ID: "BAZ"}} {
+		if err := CheckID(r, routes); err != nil {
+			t.Errorf("Unexpected error for %v: %v", r, err)
+		}
+	}
+}
+
+func TestCheckClashesReportsAnIDInUseBeforeADuplicatedRoute(t *testing.T) {
+	routes := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+
+	err := checkClashes(model.Route{ID: "FOO", Method: "GET", Pattern: "/foo"}, routes)
+
+	if !errors.Is(err, errIDInUse) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestShadowingRouteFindsTheFirstCatchAll(t *testing.T) {
+	earlier := []model.Route{
+		{ID: "FOO", Method: "POST", Pattern: "/{path}"},
+		{ID: "BAR", Method: "GET", Pattern: "/foo"},
+		{ID: "BAZ", Method: "GET", Pattern: "/{path}"},
+		{ID: "QUX", Method: "GET", Pattern: "/{path:.*}"},
+	}
+
+	r, ok := shadowingRoute(model.Route{Method: "GET", Pattern: "/hello"}, earlier)
+
+	if !ok || r.ID != "BAZ" {
+		t.Errorf("Unexpected shadowing route: %v, %v", r, ok)
+	}
+}
+
+func TestShadowingRouteTakesTheVariablesAsWritten(t *testing.T) {
+	testCases := []struct {
+		earlier, route string
+		shadowed       bool
+	}{
+		{"/users/{id}", "/users/{name}", true},
+		{"/users/{id}", "/users/{id:[0-9]+}", true},
+		{"/users/{id:[0-9]+}", "/users/{name}", false},
+		{"/users/{id}", "/users/{id}/posts", false},
+		{"/users", "/users/{id}", false},
+	}
+
+	for _, tc := range testCases {
+		earlier := []model.Route{{Method: "GET", Pattern: tc.earlier}}
+		if _, ok := shadowingRoute(model.Route{Method: "GET", Pattern: tc.route}, earlier); ok != tc.shadowed {
+			t.Errorf("Shadowing mismatch for %s after %s. Expected: %v. Got: %v", tc.route, tc.earlier, tc.shadowed, ok)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/BBVA/kapow/internal/server/httperror"
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/user"
+)
+
+// routeEvent is a change of the route list sent to the watchers, along with
+// the resulting list.  The first event of a watch is a snapshot of the
+// current list.
+type routeEvent struct {
+	Revision  int           `json:"revision"`
+	Operation string        `json:"operation"`
+	Actor     string        `json:"actor,omitempty"`
+	Routes    []model.Route `json:"routes"`
+}
+
+var (
+	// watchesDone is closed when the server shuts down, to end the
+	// running watches
+	watchesDone     = make(chan struct{})
+	stopWatchesOnce sync.Once
+)
+
+// stopWatches Ends every running watch of the route list
+func stopWatches() {
+	stopWatchesOnce.Do(func() { close(watchesDone) })
+}
+
+// funcWatch Method used to ask the route model module for the current route
+// list and its later changes
+var funcWatch func() (int, []model.Route, <-chan user.Revision, func()) = user.Routes.Watch
+
+// watchRoutes Handler that streams the current route list and then every
+// change made to it, numbered by its revision in the route history.  The
+// events are sent as Server-Sent Events if the client accepts them, or as
+// JSON lines otherwise.  The stream ends if the client falls too far
+// behind, and it can then watch again.
+func watchRoutes(res http.ResponseWriter, req *http.Request) {
+	if format := req.URL.Query().Get("format"); format != "" && format != "json" {
+		httperror.ErrorJSON(res, "Invalid Format", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		httperror.ErrorJSON(res, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	version, rs, revisions, stop := funcWatch()
+	defer stop()
+
+	sse := strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+	} else {
+		res.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	res.WriteHeader(http.StatusOK)
+
+	e := routeEvent{Revision: version, Operation: "snapshot", Routes: rs}
+	for {
+		if err := writeRouteEvent(res, sse, e); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case rev, ok := <-revisions:
+			if !ok {
+				return
+			}
+			e = routeEvent{Revision: rev.Version, Operation: rev.Operation, Actor: rev.Actor, Routes: rev.After}
+		case <-req.Context().Done():
+			return
+		case <-watchesDone:
+			return
+		}
+	}
+}
+
+// writeRouteEvent Writes e to w as a Server-Sent Event or as a JSON line
+func writeRouteEvent(w io.Writer, sse bool, e routeEvent) error {
+	b, _ := json.Marshal(e)
+	if sse {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Revision, e.Operation, b)
+		return err
+	}
+	_, err := w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/user"
+)
+
+// watchOn returns a funcWatch that sends the given revisions after the
+// snapshot and then ends the watch
+func watchOn(version int, rs []model.Route, revs ...user.Revision) func() (int, []model.Route, <-chan user.Revision, func()) {
+	return func() (int, []model.Route, <-chan user.Revision, func()) {
+		c := make(chan user.Revision, len(revs))
+		for _, rev := range revs {
+			c <- rev
+		}
+		close(c)
+		return version, rs, c, func() {}
+	}
+}
+
+func TestListRoutesReturnsBadRequestOnInvalidWatch(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?watch=maybe", nil)
+	resp := httptest.NewRecorder()
+
+	listRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Invalid Watch") {
+		t.Error(e)
+	}
+}
+
+func TestListRoutesDoesntWatchWithWatchFalse(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?watch=false", nil)
+	resp := httptest.NewRecorder()
+	funcList = func() []model.Route { return []model.Route{} }
+	funcWatch = func() (int, []model.Route, <-chan user.Revision, func()) {
+		t.Error("Routes watched")
+		return 0, nil, nil, func() {}
+	}
+
+	listRoutes(resp, req)
+
+	if v := resp.Header().Get("Content-Type"); v != "application/json" {
+		t.Errorf("Content-Type header mismatch. Expected: %q, got: %q", "application/json", v)
+	}
+}
+
+func TestWatchRoutesReturnsBadRequestOnPowFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?watch=true&format=pow", nil)
+	resp := httptest.NewRecorder()
+
+	listRoutes(resp, req)
+
+	for _, e := range checkErrorResponse(resp.Result(), http.StatusBadRequest, "Invalid Format") {
+		t.Error(e)
+	}
+}
+
+func TestWatchRoutesStreamsTheSnapshotAndTheChangesAsJSONLines(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?watch=true", nil)
+	resp := httptest.NewRecorder()
+	funcWatch = watchOn(
+		3, []model.Route{{ID: "FOO"}},
+		user.Revision{Version: 4, Operation: "append", Actor: "alice", After: []model.Route{{ID: "FOO"}, {ID: "BAR", Index: 1}}},
+		user.Revision{Version: 5, Operation: "delete", After: []model.Route{{ID: "BAR"}}},
+	)
+
+	listRoutes(resp, req)
+
+	if v := resp.Header().Get("Content-Type"); v != "application/x-ndjson" {
+		t.Errorf("Content-Type header mismatch. Expected: %q, got: %q", "application/x-ndjson", v)
+	}
+	var events []routeEvent
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		var e routeEvent
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid event %q: %v", s.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events. Got: %v", events)
+	}
+	if e := events[0]; e.Revision != 3 || e.Operation != "snapshot" || len(e.Routes) != 1 {
+		t.Errorf("Unexpected snapshot: %v", e)
+	}
+	if e := events[1]; e.Revision != 4 || e.Operation != "append" || e.Actor != "alice" || len(e.Routes) != 2 {
+		t.Errorf("Unexpected event: %v", e)
+	}
+	if e := events[2]; e.Revision != 5 || e.Operation != "delete" || len(e.Routes) != 1 {
+		t.Errorf("Unexpected event: %v", e)
+	}
+}
+
+func TestWatchRoutesStreamsServerSentEventsWhenAccepted(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?watch=true", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp := httptest.NewRecorder()
+	funcWatch = watchOn(0, []model.Route{}, user.Revision{Version: 1, Operation: "append", After: []model.Route{{ID: "FOO"}}})
+
+	listRoutes(resp, req)
+
+	if v := resp.Header().Get("Content-Type"); v != "text/event-stream" {
+		t.Errorf("Content-Type header mismatch. Expected: %q, got: %q", "text/event-stream", v)
+	}
+	expected := "id: 0\nevent: snapshot\ndata: {\"revision\":0,\"operation\":\"snapshot\",\"routes\":[]}\n\n" +
+		"id: 1\nevent: append\ndata: {\"revision\":1,\"operation\":\"append\",\"routes\":[" +
+		"{\"id\":\"FOO\",\"method\":\"\",\"url_pattern\":\"\",\"entrypoint\":\"\",\"command\":\"\",\"index\":0}]}\n\n"
+	if body := resp.Body.String(); body != expected {
+		t.Errorf("Body mismatch. Expected: %q. Got: %q", expected, body)
+	}
+}
+
+func TestWatchRoutesEndsWhenTheClientGoesAway(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/routes?watch=true", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+	resp := httptest.NewRecorder()
+	stopped := false
+	funcWatch = func() (int, []model.Route, <-chan user.Revision, func()) {
+		cancel()
+		return 0, []model.Route{}, make(chan user.Revision), func() { stopped = true }
+	}
+
+	listRoutes(resp, req)
+
+	if !stopped {
+		t.Error("Watch not stopped")
+	}
+	if !strings.Contains(resp.Body.String(), `"snapshot"`) {
+		t.Errorf("Snapshot not sent. Got: %q", resp.Body.String())
+	}
+}
@@ -17,7 +17,9 @@
 package data
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"github.com/BBVA/kapow/internal/server/httperror"
 	"github.com/BBVA/kapow/internal/server/model"
@@ -38,9 +40,27 @@ func checkHandler(fn resourceHandler) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		handlerID := mux.Vars(r)["handlerID"]
 		if h, ok := Handlers.Get(handlerID); ok {
+			if !validSecret(r, h) {
+				httperror.ErrorJSON(w, "Invalid Handler Secret", http.StatusForbidden)
+				return
+			}
+			if h.Trace.IsValid() {
+				defer startCallSpan(r, h).End()
+			}
 			fn(w, r, h)
 		} else {
 			httperror.ErrorJSON(w, "Handler ID Not Found", http.StatusNotFound)
 		}
 	}
 }
+
+// validSecret checks that r carries the secret of h, if it has one, as a
+// bearer token
+func validSecret(r *http.Request, h *model.Handler) bool {
+	if h.Secret == "" {
+		return true
+	}
+	header := r.Header.Get("Authorization")
+	secret := strings.TrimPrefix(header, "Bearer ")
+	return secret != header && subtle.ConstantTimeCompare([]byte(secret), []byte(h.Secret)) == 1
+}
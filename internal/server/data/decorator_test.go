@@ -161,3 +161,41 @@ func TestCheckHandlerReturnsAFunctionsThatCallsTheGivenCallbackWithTheProperHand
 		t.Errorf(`Handler mismatch. Expected "BAZ". Got %q`, handlerID)
 	}
 }
+
+func TestCheckHandlerReturnsAFunctionThat403sWhenTheSecretIsWrong(t *testing.T) {
+	Handlers = New()
+	Handlers.Add(&model.Handler{ID: "BAZ", Secret: "S3CR3T"})
+	fn := checkHandler(func(http.ResponseWriter, *http.Request, *model.Handler) {
+		t.Error("Callback called with a wrong secret")
+	})
+
+	for _, auth := range []string{"", "S3CR3T", "Bearer WRONG", "Bearer "} {
+		r := createMuxRequest("/handlers/{handlerID}", "/handlers/BAZ", "GET", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+
+		fn(w, r)
+
+		for _, e := range checkErrorResponse(w.Result(), http.StatusForbidden, "Invalid Handler Secret") {
+			t.Errorf("%q: %s", auth, e)
+		}
+	}
+}
+
+func TestCheckHandlerReturnsAFunctionThatCallsTheGivenCallbackWithTheRightSecret(t *testing.T) {
+	Handlers = New()
+	Handlers.Add(&model.Handler{ID: "BAZ", Secret: "S3CR3T"})
+	r := createMuxRequest("/handlers/{handlerID}", "/handlers/BAZ", "GET", nil)
+	r.Header.Set("Authorization", "Bearer S3CR3T")
+	w := httptest.NewRecorder()
+	called := false
+
+	fn := checkHandler(func(http.ResponseWriter, *http.Request, *model.Handler) { called = true })
+
+	fn(w, r)
+	if !called {
+		t.Error("Callback not called")
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/BBVA/kapow/internal/server/metrics"
+)
+
+var (
+	dataRequests = metrics.NewCounterVec(
+		"kapow_data_requests_total",
+		"Calls to the data API, by method and resource path.",
+		"method", "resource")
+	_ = metrics.NewGaugeFunc(
+		"kapow_handlers_in_flight",
+		"Requests of the user interface being handled.",
+		func() float64 { return float64(Handlers.Len()) })
+)
+
+// countRequests decorates the handler of the resource at route so every
+// call to it is counted
+func countRequests(route, method string, h http.HandlerFunc) http.HandlerFunc {
+	resource := strings.TrimPrefix(route, "/handlers/{handlerID}")
+	return func(w http.ResponseWriter, r *http.Request) {
+		dataRequests.Inc(method, resource)
+		h(w, r)
+	}
+}
@@ -17,13 +17,17 @@
 package data
 
 import (
-	"log"
+	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/BBVA/kapow/internal/server/httperror"
 	"github.com/gorilla/mux"
 )
 
+// Server is a singleton that stores the http.Server for the data package
+var Server = http.Server{Handler: dataRouter()}
+
 type routeSpec struct {
 	route  string
 	method string
@@ -33,7 +37,7 @@ type routeSpec struct {
 func configRouter(rs []routeSpec) (r *mux.Router) {
 	r = mux.NewRouter()
 	for _, s := range rs {
-		r.HandleFunc(s.route, checkHandler(s.rh)).Methods(s.method)
+		r.HandleFunc(s.route, countRequests(s.route, s.method, checkHandler(s.rh))).Methods(s.method)
 	}
 	r.HandleFunc(
 		"/handlers/{handlerID}/{resource:.*}",
@@ -43,7 +47,8 @@ func configRouter(rs []routeSpec) (r *mux.Router) {
 	return r
 }
 
-func Run(bindAddr string) {
+// dataRouter Builds the mux of the data interface
+func dataRouter() *mux.Router {
 	rs := []routeSpec{
 		// request
 		{"/handlers/{handlerID}/request/method", "GET", getRequestMethod},
@@ -65,5 +70,15 @@ func Run(bindAddr string) {
 		{"/handlers/{handlerID}/response/body", "PUT", lockResponseWriter(setResponseBody)},
 		{"/handlers/{handlerID}/response/stream", "PUT", lockResponseWriter(setResponseBody)},
 	}
-	log.Fatal(http.ListenAndServe(bindAddr, configRouter(rs)))
+	return configRouter(rs)
+}
+
+// Run Starts the data server accepting connections from l
+//
+// It returns nil when the server is shut down.
+func Run(l net.Listener) error {
+	if err := Server.Serve(l); err != http.ErrServerClosed {
+		return fmt.Errorf("DataServer failed: %s", err)
+	}
+	return nil
 }
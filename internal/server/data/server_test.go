@@ -71,6 +71,26 @@ func TestConfigRouterReturnsRouterWithDecoratedRoutes(t *testing.T) {
 	}
 }
 
+func TestConfigRouterCountsTheCallsToEachResource(t *testing.T) {
+	rs := []routeSpec{
+		{
+			"/handlers/{handlerID}/counted/{name}",
+			"PUT",
+			func(w http.ResponseWriter, r *http.Request, h *model.Handler) {},
+		},
+	}
+	Handlers = New()
+	Handlers.Add(&model.Handler{ID: "FOO"})
+	m := configRouter(rs)
+
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/handlers/FOO/counted/a", nil))
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/handlers/BAR/counted/b", nil))
+
+	if v := dataRequests.Value("PUT", "/counted/{name}"); v != 2 {
+		t.Errorf("Call count mismatch. Expected: 2. Got: %v", v)
+	}
+}
+
 func TestConfigRouterReturnsRouterThat400sOnUnconfiguredResources(t *testing.T) {
 	m := configRouter([]routeSpec{})
 	w := httptest.NewRecorder()
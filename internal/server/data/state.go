@@ -17,7 +17,9 @@
 package data
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/BBVA/kapow/internal/server/model"
 )
@@ -65,3 +67,28 @@ func (shm *safeHandlerMap) ListIDs() (ids []string) {
 	}
 	return
 }
+
+// Len returns the number of current handlers
+func (shm *safeHandlerMap) Len() int {
+	shm.m.RLock()
+	defer shm.m.RUnlock()
+	return len(shm.hs)
+}
+
+// drainPollInterval is how often Drain checks for remaining handlers
+var drainPollInterval = 50 * time.Millisecond
+
+// Drain blocks until there are no handlers left.  If ctx is done before
+// that its error is returned.
+func (shm *safeHandlerMap) Drain(ctx context.Context) error {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+	for shm.Len() != 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
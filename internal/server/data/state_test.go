@@ -19,6 +19,7 @@
 package data
 
 import (
+	"context"
 	"reflect"
 	"testing"
 	"time"
@@ -242,3 +243,51 @@ func TestListIDsNonBlockingReadWithOtherReaders(t *testing.T) {
 		t.Error("Handler couldn't read while mutex was acquired for read")
 	}
 }
+
+func TestLenReturnsTheNumberOfHandlers(t *testing.T) {
+	shm := New()
+	shm.Add(&model.Handler{ID: "FOO"})
+	shm.Add(&model.Handler{ID: "BAR"})
+
+	if n := shm.Len(); n != 2 {
+		t.Errorf("Handler count mismatch. Expected: 2. Got: %d", n)
+	}
+}
+
+func TestDrainReturnsImmediatelyWhenEmpty(t *testing.T) {
+	shm := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := shm.Drain(ctx); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDrainWaitsForHandlersToBeRemoved(t *testing.T) {
+	shm := New()
+	shm.Add(&model.Handler{ID: "FOO"})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		shm.Remove("FOO")
+	}()
+
+	if err := shm.Drain(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if shm.Len() != 0 {
+		t.Error("Drain returned before the handler was removed")
+	}
+}
+
+func TestDrainReturnsTheContextErrorWhenDone(t *testing.T) {
+	shm := New()
+	shm.Add(&model.Handler{ID: "FOO"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := shm.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Context error not returned. Got: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/tracing"
+)
+
+// startCallSpan starts the span of a data API call made by the process
+// spawned for h, as a child of its spawn span
+func startCallSpan(r *http.Request, h *model.Handler) *tracing.Span {
+	resource := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			resource = tmpl
+		}
+	}
+	span := tracing.Start("data "+r.Method+" "+resource, tracing.KindServer, h.Trace)
+	span.SetString("kapow.handler_id", h.ID)
+	span.SetString("http.request.method", r.Method)
+	span.SetString("http.route", resource)
+	return span
+}
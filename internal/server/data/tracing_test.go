@@ -0,0 +1,39 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/tracing"
+)
+
+func TestStartCallSpanIsAChildOfTheHandlerTrace(t *testing.T) {
+	sc, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h := &model.Handler{ID: "FOO", Trace: sc}
+
+	got := startCallSpan(httptest.NewRequest("GET", "/handlers/FOO/request/body", nil), h).Context()
+
+	if got.TraceID != sc.TraceID {
+		t.Errorf("Trace ID mismatch. Expected: %q. Got: %q", sc.TraceIDString(), got.TraceIDString())
+	}
+	if got.SpanID == sc.SpanID {
+		t.Error("Span ID not generated for the call")
+	}
+}
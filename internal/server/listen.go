@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix marks the bind addresses that are unix domain socket paths
+const unixPrefix = "unix:"
+
+// listen opens a listening socket in addr, wrapped with TLS when tlsConfig
+// is not nil.
+//
+// Addresses starting with "unix:" are unix domain socket paths.  A stale
+// socket file left in that path is replaced, and the new one gets the
+// permissions in mode when not zero.
+func listen(addr string, tlsConfig *tls.Config, mode os.FileMode) (net.Listener, error) {
+	var l net.Listener
+	var err error
+	if strings.HasPrefix(addr, unixPrefix) {
+		l, err = listenUnix(strings.TrimPrefix(addr, unixPrefix), mode)
+	} else {
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	return l, nil
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenOpensATCPSocket(t *testing.T) {
+	l, err := listen("127.0.0.1:0", nil, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	if l.Addr().Network() != "tcp" {
+		t.Errorf(`Network mismatch. Expected: "tcp". Got: %q`, l.Addr().Network())
+	}
+}
+
+func TestListenOpensAUnixSocketWithTheGivenMode(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-listen")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control.sock")
+
+	l, err := listen("unix:"+path, nil, 0660)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		t.Error("Socket file not created")
+	}
+	if fi.Mode().Perm() != 0660 {
+		t.Errorf("Mode mismatch. Expected: %v. Got: %v", os.FileMode(0660), fi.Mode().Perm())
+	}
+}
+
+func TestListenReplacesStaleUnixSockets(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-listen")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control.sock")
+	stale, _ := net.Listen("unix", path)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen("unix:"+path, nil, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l.Close()
+}
+
+func TestListenDoesntReplaceRegularFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-listen")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control.sock")
+	_ = ioutil.WriteFile(path, []byte("FOO"), 0600)
+
+	if l, err := listen("unix:"+path, nil, 0); err == nil {
+		l.Close()
+		t.Error("Expected error not returned")
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "FOO" {
+		t.Error("Regular file replaced")
+	}
+}
+
+func TestServiceURLReturnsUnixAddressesAsIs(t *testing.T) {
+	c := ServerConfig{DataBindAddr: "unix:/run/kapow/data.sock"}
+
+	if u := c.DataURL(); u != "unix:/run/kapow/data.sock" {
+		t.Errorf(`URL mismatch. Expected: "unix:/run/kapow/data.sock". Got: %q`, u)
+	}
+}
+
+func TestServiceURLUsesHTTPSWhenSecure(t *testing.T) {
+	c := ServerConfig{ControlBindAddr: "localhost:8081", ControlCertFile: "cert.pem"}
+
+	if u := c.ControlURL(); u != "https://localhost:8081" {
+		t.Errorf(`URL mismatch. Expected: "https://localhost:8081". Got: %q`, u)
+	}
+}
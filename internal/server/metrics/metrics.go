@@ -0,0 +1,323 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics implements the subset of the Prometheus client needed
+// to expose the Kapow! metrics in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the histogram buckets
+// used for latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can be written in the text format
+type collector interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+var (
+	registryLock sync.Mutex
+	registry     []collector
+)
+
+func register(c collector) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, c)
+}
+
+// labelSep separates the label values in the keys of the series maps, as
+// it can't be part of a valid UTF-8 label value
+const labelSep = "\xff"
+
+// family holds the data shared by every metric type
+type family struct {
+	name, help string
+	labels     []string
+}
+
+func (f *family) metricName() string {
+	return f.name
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, labelSep)
+}
+
+// labelValues splits key back into the label values it was built from
+func (f *family) labelValues(key string) []string {
+	if len(f.labels) == 0 {
+		return nil
+	}
+	return strings.Split(key, labelSep)
+}
+
+func (f *family) writeHeader(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, typ)
+}
+
+// labelPairs formats the label pairs of the series identified by key,
+// followed by the extra pairs given, e.g. le="0.5"
+func (f *family) labelPairs(key string, extra ...string) string {
+	values := f.labelValues(key)
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, v := range values {
+		pairs = append(pairs, f.labels[i]+"="+quoteLabel(v))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quoteLabel(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter partitioned by a set of labels
+type CounterVec struct {
+	family
+	m      sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a counter with the given labels
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: family{name, help, labels}, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc increments by one the counter of the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter of the given label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	k := c.key(values)
+	c.m.Lock()
+	c.values[k] += v
+	c.m.Unlock()
+}
+
+// Value returns the current value of the counter of the given label values
+func (c *CounterVec) Value(values ...string) float64 {
+	k := c.key(values)
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.values[k]
+}
+
+// Retain removes the series whose label values, in the order of the labels
+// of the counter, don't satisfy keep
+func (c *CounterVec) Retain(keep func(values []string) bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for k := range c.values {
+		if !keep(c.labelValues(k)) {
+			delete(c.values, k)
+		}
+	}
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.writeHeader(w, "counter")
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(k), formatFloat(c.values[k]))
+	}
+}
+
+// histogram is a single series of a HistogramVec
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a histogram partitioned by a set of labels
+type HistogramVec struct {
+	family
+	buckets []float64
+	m       sync.Mutex
+	values  map[string]*histogram
+}
+
+// NewHistogramVec creates and registers a histogram with the given bucket
+// upper bounds, in increasing order, and labels
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		family:  family{name, help, labels},
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds v to the histogram of the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	s, ok := h.values[k]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations of the given label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	k := h.key(values)
+	h.m.Lock()
+	defer h.m.Unlock()
+	if s, ok := h.values[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// Retain removes the series whose label values, in the order of the labels
+// of the histogram, don't satisfy keep
+func (h *HistogramVec) Retain(keep func(values []string) bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for k := range h.values {
+		if !keep(h.labelValues(k)) {
+			delete(h.values, k)
+		}
+	}
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.writeHeader(w, "histogram")
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.values[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(k), s.count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is obtained when it is collected
+type GaugeFunc struct {
+	family
+	f func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge whose value is returned by f
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	g := &GaugeFunc{family: family{name: name, help: help}, f: f}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.writeHeader(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.f()))
+}
+
+// Write writes every registered metric, sorted by name, in the Prometheus
+// text format
+func Write(w io.Writer) error {
+	registryLock.Lock()
+	cs := make([]collector, len(registry))
+	copy(cs, registry)
+	registryLock.Unlock()
+
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].metricName() < cs[j].metricName() })
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registered metrics in the Prometheus text format
+func Handler(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = Write(res)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func quoteLabel(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(c collector) string {
+	var buf bytes.Buffer
+	c.write(&buf)
+	return buf.String()
+}
+
+func TestCounterVecWritesOneSampleForEachLabelSet(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A counter.", "route", "status")
+	c.Inc("b", "200")
+	c.Inc("a", "500")
+	c.Add(2, "b", "200")
+
+	expected := `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{route="a",status="500"} 1
+test_counter_total{route="b",status="200"} 3
+`
+	if got := render(c); got != expected {
+		t.Errorf("Output mismatch. Expected: %q. Got: %q", expected, got)
+	}
+}
+
+func TestCounterVecValueReturnsTheCurrentCount(t *testing.T) {
+	c := NewCounterVec("test_value_total", "A counter.", "op")
+	c.Inc("add")
+	c.Inc("add")
+
+	if v := c.Value("add"); v != 2 {
+		t.Errorf("Value mismatch. Expected: 2. Got: %v", v)
+	}
+	if v := c.Value("remove"); v != 0 {
+		t.Errorf("Value mismatch. Expected: 0. Got: %v", v)
+	}
+}
+
+func TestCounterVecPanicsWithTheWrongNumberOfLabels(t *testing.T) {
+	c := NewCounterVec("test_panic_total", "A counter.", "op")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic didn't happen")
+		}
+	}()
+
+	c.Inc("add", "extra")
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	c := NewCounterVec("test_escape_total", "Help with a \\ and a\nnewline.", "pattern")
+	c.Inc("/a\\b\"c\nd")
+
+	expected := `# HELP test_escape_total Help with a \\ and a\nnewline.
+# TYPE test_escape_total counter
+test_escape_total{pattern="/a\\b\"c\nd"} 1
+`
+	if got := render(c); got != expected {
+		t.Errorf("Output mismatch. Expected: %q. Got: %q", expected, got)
+	}
+}
+
+func TestRetainRemovesTheOtherSeries(t *testing.T) {
+	c := NewCounterVec("test_retain_total", "A counter.", "route", "status")
+	c.Inc("a", "200")
+	c.Inc("b", "200")
+	h := NewHistogramVec("test_retain_seconds", "A histogram.", []float64{1}, "route")
+	h.Observe(0.5, "a")
+	h.Observe(0.5, "b")
+
+	keep := func(values []string) bool { return values[0] == "a" }
+	c.Retain(keep)
+	h.Retain(keep)
+
+	if v := c.Value("a", "200"); v != 1 {
+		t.Errorf("Value mismatch. Expected: 1. Got: %v", v)
+	}
+	if strings.Contains(render(c), `route="b"`) {
+		t.Errorf("Removed series written: %q", render(c))
+	}
+	if n := h.Count("a"); n != 1 {
+		t.Errorf("Count mismatch. Expected: 1. Got: %d", n)
+	}
+	if strings.Contains(render(h), `route="b"`) {
+		t.Errorf("Removed series written: %q", render(h))
+	}
+}
+
+func TestHistogramVecWritesCumulativeBuckets(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "A histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+
+	expected := `# HELP test_duration_seconds A histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="a",le="0.1"} 1
+test_duration_seconds_bucket{route="a",le="1"} 2
+test_duration_seconds_bucket{route="a",le="+Inf"} 3
+test_duration_seconds_sum{route="a"} 3.55
+test_duration_seconds_count{route="a"} 3
+`
+	if got := render(h); got != expected {
+		t.Errorf("Output mismatch. Expected: %q. Got: %q", expected, got)
+	}
+	if n := h.Count("a"); n != 3 {
+		t.Errorf("Count mismatch. Expected: 3. Got: %d", n)
+	}
+}
+
+func TestGaugeFuncWritesTheCurrentValue(t *testing.T) {
+	v := 1.0
+	g := NewGaugeFunc("test_gauge", "A gauge.", func() float64 { return v })
+	v = 4
+
+	expected := "# HELP test_gauge A gauge.\n# TYPE test_gauge gauge\ntest_gauge 4\n"
+	if got := render(g); got != expected {
+		t.Errorf("Output mismatch. Expected: %q. Got: %q", expected, got)
+	}
+}
+
+func TestHandlerWritesEveryMetricSortedByName(t *testing.T) {
+	NewCounterVec("test_sort_z_total", "Last.").Inc()
+	NewCounterVec("test_sort_a_total", "First.").Inc()
+	resp := httptest.NewRecorder()
+
+	Handler(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := resp.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Incorrect content type in response. Got: %q", ct)
+	}
+	body := resp.Body.String()
+	a, z := strings.Index(body, "test_sort_a_total 1\n"), strings.Index(body, "test_sort_z_total 1\n")
+	if a < 0 || z < 0 || a > z {
+		t.Errorf("Unexpected output: %s", body)
+	}
+}
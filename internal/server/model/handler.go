@@ -18,7 +18,11 @@ package model
 
 import (
 	"net/http"
+	"os"
 	"sync"
+	"time"
+
+	"github.com/BBVA/kapow/internal/server/tracing"
 )
 
 // Handler represents an open HTTP connection in the User Server.
@@ -29,6 +33,10 @@ type Handler struct {
 	// ID is unique identifier of the request.
 	ID string
 
+	// Secret, when not empty, must be presented as a bearer token on
+	// every data API call for this handler.
+	Secret string
+
 	// Route is the original route that matched this request.
 	Route
 
@@ -41,4 +49,58 @@ type Handler struct {
 
 	// Writer is the original http.ResponseWriter of the request.
 	Writer http.ResponseWriter
+
+	// Trace is the span context of the spawned process, the parent of
+	// the spans of its data API calls.
+	Trace tracing.SpanContext
+
+	// Started is when the request started being handled.
+	Started time.Time
+
+	// process is the spawned process, once started, and cancelled is set
+	// when the handler is cancelled.  Both are guarded by processM.
+	processM  sync.Mutex
+	process   *os.Process
+	cancelled bool
+}
+
+// SetProcess records p as the process spawned for the handler.  It returns
+// false if the handler has already been cancelled, in which case p must be
+// killed right away.
+func (h *Handler) SetProcess(p *os.Process) bool {
+	h.processM.Lock()
+	defer h.processM.Unlock()
+
+	h.process = p
+	return !h.cancelled
+}
+
+// PID returns the process ID of the spawned process, or 0 if it hasn't
+// been started yet
+func (h *Handler) PID() int {
+	h.processM.Lock()
+	defer h.processM.Unlock()
+
+	if h.process == nil {
+		return 0
+	}
+	return h.process.Pid
+}
+
+// Cancel marks the handler as cancelled and returns its spawned process,
+// or nil if it hasn't been started yet
+func (h *Handler) Cancel() *os.Process {
+	h.processM.Lock()
+	defer h.processM.Unlock()
+
+	h.cancelled = true
+	return h.process
+}
+
+// Cancelled tells whether the handler has been cancelled
+func (h *Handler) Cancelled() bool {
+	h.processM.Lock()
+	defer h.processM.Unlock()
+
+	return h.cancelled
 }
@@ -42,4 +42,9 @@ type Route struct {
 	// Index is this route position in the server's routes list.
 	// It is an output field, its value is ignored as input.
 	Index int `json:"index"`
+
+	// PowFile is the path of the pow file, or configuration file, that
+	// created this Route, if any.  The routes of a pow file are replaced
+	// when it is reloaded.
+	PowFile string `json:"pow_file,omitempty"`
 }
@@ -17,17 +17,263 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BBVA/kapow/internal/server/accesslog"
+	"github.com/BBVA/kapow/internal/server/certs"
 	"github.com/BBVA/kapow/internal/server/control"
 	"github.com/BBVA/kapow/internal/server/data"
+	"github.com/BBVA/kapow/internal/server/tracing"
 	"github.com/BBVA/kapow/internal/server/user"
+	"github.com/BBVA/kapow/internal/server/user/mux"
+	"github.com/BBVA/kapow/internal/server/user/spawn"
 )
 
-// StartServer Starts one instance of each server in a goroutine and remains listening on a channel for trace events generated by them
-func StartServer(controlBindAddr, dataBindAddr, userBindAddr string) {
-	go control.Run(controlBindAddr)
-	go data.Run(dataBindAddr)
-	go user.Run(userBindAddr)
+// ServerConfig holds the settings needed to start the Kapow! servers
+type ServerConfig struct {
+	ControlBindAddr,
+	DataBindAddr,
+	UserBindAddr string
+
+	// CertFile and KeyFile enable HTTPS on the user interface when both
+	// are set
+	CertFile,
+	KeyFile string
+
+	// RedirectBindAddr, when set, is where a plain HTTP server redirecting
+	// every request to the HTTPS user interface will listen
+	RedirectBindAddr string
+
+	// ControlCertFile, ControlKeyFile and ControlCAFile enable mutual TLS
+	// on the control interface when set
+	ControlCertFile,
+	ControlKeyFile,
+	ControlCAFile string
+
+	// DataCertFile, DataKeyFile and DataCAFile enable mutual TLS on the
+	// data interface when set
+	DataCertFile,
+	DataKeyFile,
+	DataCAFile string
+
+	// HandlerCertFile, HandlerKeyFile and HandlerCAFile, when set, are the
+	// client certificate and CA bundle given to the spawned handlers and
+	// pow files to reach the control and data interfaces over mutual TLS
+	HandlerCertFile,
+	HandlerKeyFile,
+	HandlerCAFile string
+
+	// ControlSocketMode and DataSocketMode are the permissions of the
+	// socket files of the control and data interfaces when they are bound
+	// to a unix domain socket
+	ControlSocketMode,
+	DataSocketMode os.FileMode
+
+	// HealthBindAddr, when set, is where a plain HTTP server exposing only
+	// the health endpoints of the control interface will listen
+	HealthBindAddr string
+
+	// AccessLogPath, when set, is the file where a line is written for
+	// every user request, or accesslog.Stdout.  AccessLogFormat is the
+	// layout of these lines.
+	AccessLogPath,
+	AccessLogFormat string
+
+	// OTLPEndpoint, when set, is the base URL of the OTLP/HTTP collector
+	// the spans are exported to, e.g. http://localhost:4318
+	OTLPEndpoint string
+
+	// HandlerSecrets makes every handler get a random secret that the
+	// data interface requires on each call for it
+	HandlerSecrets bool
+}
+
+// ControlURL returns the URL the clients of the control interface must use
+func (c ServerConfig) ControlURL() string {
+	return serviceURL(c.ControlBindAddr, c.ControlCertFile != "")
+}
+
+// DataURL returns the URL the clients of the data interface must use
+func (c ServerConfig) DataURL() string {
+	return serviceURL(c.DataBindAddr, c.DataCertFile != "")
+}
+
+// ClientEnv returns the environment variables that make the kapow commands
+// run by the spawned processes use the client certificate and CA bundle of
+// the handlers
+func (c ServerConfig) ClientEnv() []string {
+	var env []string
+	if c.HandlerCertFile != "" {
+		env = append(env, "KAPOW_CLIENT_CERTFILE="+c.HandlerCertFile)
+	}
+	if c.HandlerKeyFile != "" {
+		env = append(env, "KAPOW_CLIENT_KEYFILE="+c.HandlerKeyFile)
+	}
+	if c.HandlerCAFile != "" {
+		env = append(env, "KAPOW_CAFILE="+c.HandlerCAFile)
+	}
+	return env
+}
+
+func serviceURL(bindAddr string, secure bool) string {
+	if strings.HasPrefix(bindAddr, unixPrefix) {
+		return bindAddr
+	}
+	if secure {
+		return "https://" + bindAddr
+	}
+	return "http://" + bindAddr
+}
+
+// errs receives the error of any server that stops running unexpectedly
+var errs = make(chan error, 4)
+
+// StartServer starts the control and data servers in a goroutine each.
+//
+// The listening sockets are opened before returning, so any error binding
+// them is returned right away and the servers are ready to accept
+// connections when this function returns.  The returned channel receives
+// the error of any server that stops running unexpectedly.
+func StartServer(config ServerConfig) (<-chan error, error) {
+	var controlTLS, dataTLS *tls.Config
+	var err error
+	if config.ControlCertFile != "" {
+		if controlTLS, err = certs.MutualTLSConfig(config.ControlCertFile, config.ControlKeyFile, config.ControlCAFile); err != nil {
+			return nil, err
+		}
+	}
+	if config.DataCertFile != "" {
+		if dataTLS, err = certs.MutualTLSConfig(config.DataCertFile, config.DataKeyFile, config.DataCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var accessLog *accesslog.Logger
+	if config.AccessLogPath != "" {
+		format, err := accesslog.ParseFormat(config.AccessLogFormat)
+		if err != nil {
+			return nil, err
+		}
+		if accessLog, err = accesslog.New(config.AccessLogPath, format); err != nil {
+			return nil, err
+		}
+		accessLog.ReopenOn(syscall.SIGHUP)
+	}
+
+	if config.OTLPEndpoint != "" {
+		tracing.SetExporter(tracing.NewExporter(config.OTLPEndpoint))
+	}
+
+	spawn.SetEnv(config.ClientEnv())
+	user.Configure(mux.Config{
+		DataURL:        config.DataURL(),
+		AccessLog:      accessLog,
+		HandlerSecrets: config.HandlerSecrets,
+	})
+
+	controlListener, err := listen(config.ControlBindAddr, controlTLS, config.ControlSocketMode)
+	if err != nil {
+		return nil, err
+	}
+	dataListener, err := listen(config.DataBindAddr, dataTLS, config.DataSocketMode)
+	if err != nil {
+		controlListener.Close()
+		return nil, err
+	}
+
+	if config.HealthBindAddr != "" {
+		healthListener, err := listen(config.HealthBindAddr, nil, 0)
+		if err != nil {
+			controlListener.Close()
+			dataListener.Close()
+			return nil, err
+		}
+		go run(func() error { return control.RunHealth(healthListener) })
+	}
+
+	go run(func() error { return control.Run(controlListener) })
+	go run(func() error { return data.Run(dataListener) })
+
+	return errs, nil
+}
+
+// StartUserServer starts the user server, and the HTTP to HTTPS
+// redirection server if configured, in a goroutine each.  Errors running
+// them are sent to the channel returned by StartServer.
+//
+// The server is reported as ready from then on, so this must be called
+// once the initial routes are in place.
+func StartUserServer(config ServerConfig) error {
+	var userTLS *tls.Config
+	var err error
+	if config.CertFile != "" {
+		if userTLS, err = certs.TLSConfig(config.CertFile, config.KeyFile); err != nil {
+			return err
+		}
+	}
+
+	userListener, err := listen(config.UserBindAddr, userTLS, 0)
+	if err != nil {
+		return err
+	}
+
+	if config.RedirectBindAddr != "" {
+		_, port, err := net.SplitHostPort(config.UserBindAddr)
+		if err != nil {
+			userListener.Close()
+			return err
+		}
+		redirectListener, err := listen(config.RedirectBindAddr, nil, 0)
+		if err != nil {
+			userListener.Close()
+			return err
+		}
+		user.ConfigureRedirect(port)
+		go run(func() error { return user.RunRedirect(redirectListener) })
+	}
+
+	go run(func() error { return user.Run(userListener) })
+	control.SetReady(true)
+
+	return nil
+}
+
+func run(f func() error) {
+	if err := f(); err != nil {
+		errs <- err
+	}
+}
+
+// Shutdown stops the servers gracefully.  The server is reported as not
+// ready and the user interface stops accepting requests right away, while
+// the data and control interfaces are kept running until every in-flight
+// handler has finished or ctx is done.
+//
+// An error is returned if some handlers were still running when ctx was
+// done.
+func Shutdown(ctx context.Context) error {
+	control.SetReady(false)
+	_ = user.Shutdown(ctx)
+	drainErr := data.Handlers.Drain(ctx)
+
+	// Give the data and control interfaces the chance to answer the
+	// requests they are processing even if the deadline is over
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = data.Server.Shutdown(ctx)
+	_ = control.Server.Shutdown(ctx)
+	_ = control.HealthServer.Shutdown(ctx)
+	_ = tracing.Shutdown(ctx)
 
-	// Wait for ever
-	select {}
+	if drainErr != nil {
+		return fmt.Errorf("%d handlers still running at shutdown: %s", data.Handlers.Len(), drainErr)
+	}
+	return nil
 }
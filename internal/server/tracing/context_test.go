@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+const sampleTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparentParsesAValidHeader(t *testing.T) {
+	sc, ok := ParseTraceparent(sampleTraceparent)
+
+	if !ok {
+		t.Fatal("Valid traceparent rejected")
+	}
+	if id := sc.TraceIDString(); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Trace ID mismatch. Got: %q", id)
+	}
+	if id := sc.SpanIDString(); id != "00f067aa0ba902b7" {
+		t.Errorf("Span ID mismatch. Got: %q", id)
+	}
+	if !sc.Sampled {
+		t.Error("Sampled flag not parsed")
+	}
+}
+
+func TestTraceparentRoundTrips(t *testing.T) {
+	for _, s := range []string{sampleTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"} {
+		sc, _ := ParseTraceparent(s)
+		if got := sc.Traceparent(); got != s {
+			t.Errorf("Traceparent mismatch. Expected: %q. Got: %q", s, got)
+		}
+	}
+}
+
+func TestParseTraceparentAcceptsFutureVersions(t *testing.T) {
+	if _, ok := ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds"); !ok {
+		t.Error("Future version rejected")
+	}
+}
+
+func TestParseTraceparentRejectsInvalidHeaders(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"garbage",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		if _, ok := ParseTraceparent(s); ok {
+			t.Errorf("Invalid traceparent accepted: %q", s)
+		}
+	}
+}
+
+func TestFromRequestReadsTheTraceparentHeader(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Traceparent", sampleTraceparent)
+
+	if sc := FromRequest(r); sc.Traceparent() != sampleTraceparent {
+		t.Errorf("Span context mismatch. Got: %q", sc.Traceparent())
+	}
+}
+
+func TestFromRequestReturnsAnInvalidContextWithoutHeader(t *testing.T) {
+	if FromRequest(httptest.NewRequest("GET", "/", nil)).IsValid() {
+		t.Error("Unexpected valid span context")
+	}
+	if FromRequest(nil).IsValid() {
+		t.Error("Unexpected valid span context")
+	}
+}
+
+func TestStartContinuesTheParentTrace(t *testing.T) {
+	parent, _ := ParseTraceparent(sampleTraceparent)
+
+	sc := Start("child", KindInternal, parent).Context()
+
+	if sc.TraceID != parent.TraceID {
+		t.Error("Trace ID not inherited from the parent")
+	}
+	if sc.SpanID == parent.SpanID || !sc.IsValid() {
+		t.Error("Span ID not generated")
+	}
+	if !sc.Sampled {
+		t.Error("Sampled flag not inherited from the parent")
+	}
+}
+
+func TestStartBeginsANewSampledTraceWithoutParent(t *testing.T) {
+	sc := Start("root", KindServer, SpanContext{}).Context()
+
+	if !sc.IsValid() || !sc.Sampled {
+		t.Errorf("Unexpected span context: %q", sc.Traceparent())
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceName is the service.name resource attribute of the exported spans
+const ServiceName = "kapow"
+
+const (
+	exportQueueSize = 2048
+	exportBatchSize = 512
+	exportInterval  = 2 * time.Second
+)
+
+var (
+	exporterLock sync.RWMutex
+	exporter     *Exporter
+)
+
+// SetExporter makes every ended span be sent to e.  A nil e disables the
+// export of spans.
+func SetExporter(e *Exporter) {
+	exporterLock.Lock()
+	exporter = e
+	exporterLock.Unlock()
+}
+
+func getExporter() *Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return exporter
+}
+
+// Shutdown flushes the spans pending in the configured exporter, if any
+func Shutdown(ctx context.Context) error {
+	if e := getExporter(); e != nil {
+		return e.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Exporter sends spans in batches to an OTLP/HTTP collector, using the
+// JSON encoding.  Spans are dropped when they arrive faster than they can
+// be sent.
+type Exporter struct {
+	url    string
+	client *http.Client
+	spans  chan *Span
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewExporter returns an Exporter sending the spans to the OTLP/HTTP
+// collector at endpoint, e.g. http://localhost:4318
+func NewExporter(endpoint string) *Exporter {
+	e := &Exporter{
+		url:    strings.TrimRight(endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: 10 * time.Second},
+		spans:  make(chan *Span, exportQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *Exporter) export(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+// Shutdown sends the pending spans and stops e.  It returns when they have
+// been sent or ctx is done.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			log.Printf("Export of %d spans failed: %s", len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-e.spans:
+			if batch = append(batch, s); len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Exporter) send(spans []*Span) error {
+	body, err := json.Marshal(exportRequest(spans))
+	if err != nil {
+		return err
+	}
+	res, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("collector answered %s", res.Status)
+	}
+	return nil
+}
+
+// The types below follow the JSON encoding of the OTLP
+// ExportTraceServiceRequest message
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// statusError is the OTLP status code of a failed span.  The status of the
+// rest is left unset.
+const statusError = 2
+
+func exportRequest(spans []*Span) otlpRequest {
+	ss := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		ss[i] = s.otlp()
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", ServiceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: ServiceName}, Spans: ss}},
+	}}}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	o := otlpSpan{
+		TraceID:           s.ctx.TraceIDString(),
+		SpanID:            s.ctx.SpanIDString(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parent != [8]byte{} {
+		o.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attrs {
+		switch v := a.value.(type) {
+		case string:
+			o.Attributes = append(o.Attributes, stringAttribute(a.key, v))
+		case int64:
+			i := strconv.FormatInt(v, 10)
+			o.Attributes = append(o.Attributes, otlpAttribute{Key: a.key, Value: otlpValue{IntValue: &i}})
+		}
+	}
+	if s.failed {
+		o.Status = otlpStatus{Code: statusError, Message: s.statusMsg}
+	}
+	return o
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
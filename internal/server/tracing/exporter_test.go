@@ -0,0 +1,135 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is a stand-in for an OTLP/HTTP collector that keeps the
+// requests it receives
+type collector struct {
+	m    sync.Mutex
+	path string
+	reqs []otlpRequest
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	var req otlpRequest
+	_ = json.Unmarshal(b, &req)
+
+	c.m.Lock()
+	c.path = r.URL.Path
+	c.reqs = append(c.reqs, req)
+	c.m.Unlock()
+}
+
+func (c *collector) spans() (spans []otlpSpan) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for _, r := range c.reqs {
+		for _, rs := range r.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return
+}
+
+func exportTo(c *collector) (*Exporter, func()) {
+	srv := httptest.NewServer(c)
+	e := NewExporter(srv.URL + "/")
+	SetExporter(e)
+	return e, func() {
+		SetExporter(nil)
+		srv.Close()
+	}
+}
+
+func TestExporterSendsTheEndedSpansOnShutdown(t *testing.T) {
+	c := &collector{}
+	e, cleanup := exportTo(c)
+	defer cleanup()
+
+	parent, _ := ParseTraceparent(sampleTraceparent)
+	s := Start("GET /hello", KindServer, parent)
+	s.SetString("http.route", "/hello")
+	s.SetInt("http.response.status_code", 500)
+	s.SetError("Internal Server Error")
+	s.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if c.path != "/v1/traces" {
+		t.Errorf(`Path mismatch. Expected: "/v1/traces". Got: %q`, c.path)
+	}
+	spans := c.spans()
+	if len(spans) != 1 {
+		t.Fatalf("Span count mismatch. Expected: 1. Got: %d", len(spans))
+	}
+	got := spans[0]
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.ParentSpanID != "00f067aa0ba902b7" || got.SpanID != s.Context().SpanIDString() {
+		t.Errorf("Span IDs mismatch. Got: %+v", got)
+	}
+	if got.Name != "GET /hello" || got.Kind != KindServer {
+		t.Errorf("Span name or kind mismatch. Got: %+v", got)
+	}
+	if got.Status.Code != statusError || got.Status.Message != "Internal Server Error" {
+		t.Errorf("Span status mismatch. Got: %+v", got.Status)
+	}
+	if len(got.Attributes) != 2 || *got.Attributes[0].Value.StringValue != "/hello" || *got.Attributes[1].Value.IntValue != "500" {
+		t.Errorf("Span attributes mismatch. Got: %+v", got.Attributes)
+	}
+	if got.StartTimeUnixNano == "" || got.EndTimeUnixNano < got.StartTimeUnixNano {
+		t.Errorf("Span times mismatch. Got: %+v", got)
+	}
+}
+
+func TestExporterIgnoresUnsampledSpans(t *testing.T) {
+	c := &collector{}
+	e, cleanup := exportTo(c)
+	defer cleanup()
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	Start("GET /hello", KindServer, parent).End()
+	_ = e.Shutdown(context.Background())
+
+	if n := len(c.spans()); n != 0 {
+		t.Errorf("Span count mismatch. Expected: 0. Got: %d", n)
+	}
+}
+
+func TestShutdownWithoutExporterDoesNothing(t *testing.T) {
+	SetExporter(nil)
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"sync"
+	"time"
+)
+
+// Kind is the role of a span in the trace, as defined by OpenTelemetry
+type Kind int
+
+const (
+	// KindInternal is an operation inside the server
+	KindInternal Kind = 1
+	// KindServer is the handling of a request from a remote client
+	KindServer Kind = 2
+)
+
+// attribute is a key-value pair describing a span.  Its value is either a
+// string or an int64.
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// Span is a timed operation that is part of a trace
+type Span struct {
+	name   string
+	kind   Kind
+	ctx    SpanContext
+	parent [8]byte
+
+	m         sync.Mutex
+	start     time.Time
+	end       time.Time
+	attrs     []attribute
+	failed    bool
+	statusMsg string
+}
+
+// Start starts a span with the given parent.  A new sampled trace is
+// started when parent is not valid.
+func Start(name string, kind Kind, parent SpanContext) *Span {
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	if parent.IsValid() {
+		s.ctx = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+		s.parent = parent.SpanID
+	} else {
+		s.ctx = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	s.ctx.SpanID = newSpanID()
+	return s
+}
+
+// Context returns the span context of s, to be propagated to its children
+func (s *Span) Context() SpanContext {
+	return s.ctx
+}
+
+// SetString adds a string attribute to s
+func (s *Span) SetString(key, value string) {
+	s.m.Lock()
+	s.attrs = append(s.attrs, attribute{key, value})
+	s.m.Unlock()
+}
+
+// SetInt adds an integer attribute to s
+func (s *Span) SetInt(key string, value int) {
+	s.m.Lock()
+	s.attrs = append(s.attrs, attribute{key, int64(value)})
+	s.m.Unlock()
+}
+
+// SetError marks s as failed with the given message
+func (s *Span) SetError(msg string) {
+	s.m.Lock()
+	s.failed, s.statusMsg = true, msg
+	s.m.Unlock()
+}
+
+// End finishes s and hands it to the configured exporter, if any and the
+// span is sampled
+func (s *Span) End() {
+	s.m.Lock()
+	s.end = time.Now()
+	s.m.Unlock()
+
+	if s.ctx.Sampled {
+		if e := getExporter(); e != nil {
+			e.export(s)
+		}
+	}
+}
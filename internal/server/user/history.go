@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"errors"
+	"time"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// HistorySize is the number of revisions of the route list kept in memory
+const HistorySize = 100
+
+// Revision is a change made to the route list
+type Revision struct {
+	// Version numbers the revisions in the order they were made, starting
+	// from 1
+	Version int `json:"version"`
+	// Time is when the change was made
+	Time time.Time `json:"time"`
+	// Operation is the kind of change: append, insert, update, delete,
+	// replace_all, merge, batch, reload or rollback
+	Operation string `json:"operation"`
+	// Actor is who made the change: the identity of the client when the
+	// control API requires authentication, or the pow file being reloaded
+	Actor string `json:"actor,omitempty"`
+	// Before and After are the whole route list around the change
+	Before []model.Route `json:"before"`
+	After  []model.Route `json:"after"`
+}
+
+type history struct {
+	revisions []Revision
+	last      int
+
+	// watchers receive every new revision
+	watchers map[chan Revision]bool
+}
+
+// History returns the revisions of the route list kept, oldest first
+func (srl *safeRouteList) History() []Revision {
+	srl.m.RLock()
+	defer srl.m.RUnlock()
+
+	hs := make([]Revision, len(srl.history.revisions))
+	copy(hs, srl.history.revisions)
+	return hs
+}
+
+// Rollback restores the route list as it was right after the given version,
+// in a single step.  The rollback is recorded as a new revision.
+func (srl *safeRouteList) Rollback(actor string, version int) error {
+	srl.m.Lock()
+	for _, rev := range srl.history.revisions {
+		if rev.Version == version {
+			before := numbered(srl.rs)
+			srl.rs = make([]model.Route, len(rev.After))
+			copy(srl.rs, rev.After)
+			srl.record("rollback", actor, before)
+			srl.m.Unlock()
+			srl.changed()
+			return nil
+		}
+	}
+	srl.m.Unlock()
+	return errors.New("Version not found")
+}
+
+// record adds a revision with the current route list as its result,
+// forgetting the oldest one when there are already HistorySize, and sends
+// it to the watchers.  It must be called with srl.m locked.
+func (srl *safeRouteList) record(operation, actor string, before []model.Route) {
+	h := srl.history
+	h.last++
+	rev := Revision{
+		Version:   h.last,
+		Time:      time.Now(),
+		Operation: operation,
+		Actor:     actor,
+		Before:    before,
+		After:     numbered(srl.rs),
+	}
+	h.revisions = append(h.revisions, rev)
+	if len(h.revisions) > HistorySize {
+		h.revisions = h.revisions[len(h.revisions)-HistorySize:]
+	}
+	h.notify(rev)
+}
+
+// numbered returns a copy of rs with the index of every route set to its
+// position
+func numbered(rs []model.Route) []model.Route {
+	c := make([]model.Route, len(rs))
+	copy(c, rs)
+	for i := range c {
+		c[i].Index = i
+	}
+	return c
+}
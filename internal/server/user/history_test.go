@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestHistoryIsEmptyForANewList(t *testing.T) {
+	srl := New()
+
+	if hs := srl.History(); len(hs) != 0 {
+		t.Errorf("Unexpected revisions: %v", hs)
+	}
+}
+
+func TestHistoryRecordsEveryChange(t *testing.T) {
+	srl := New()
+	_, _ = srl.AppendBy("alice", model.Route{ID: "FOO"}, nil)
+	_, _ = srl.InsertBy("bob", model.Route{ID: "BAR"}, 0, nil)
+	_, _ = srl.UpdateBy("alice", "FOO", func(r *model.Route, _ []model.Route) error { r.Pattern = "/foo"; return nil })
+	_ = srl.DeleteBy("bob", "BAR")
+	_ = srl.MergeBy("alice", []model.Route{{ID: "BAZ"}}, nil)
+	_ = srl.ReplaceAllBy("bob", []model.Route{}, nil)
+	_, _ = srl.BatchBy("alice", func(rs []model.Route) ([]model.Route, error) { return rs, nil })
+
+	var got []string
+	for _, rev := range srl.History() {
+		got = append(got, rev.Operation+" "+rev.Actor)
+	}
+	expected := []string{"append alice", "insert bob", "update alice", "delete bob", "merge alice", "replace_all bob", "batch alice"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("History mismatch. Expected: %v. Got: %v", expected, got)
+	}
+}
+
+func TestHistoryNumbersTheRevisionsInOrder(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAR"})
+
+	for i, rev := range srl.History() {
+		if rev.Version != i+1 {
+			t.Errorf("Version mismatch. Expected: %d. Got: %d", i+1, rev.Version)
+		}
+	}
+}
+
+func TestHistoryKeepsTheRouteListsAroundEachChange(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAR"})
+
+	rev := srl.History()[1]
+	before := []model.Route{{ID: "FOO", Index: 0}}
+	after := []model.Route{{ID: "FOO", Index: 0}, {ID: "BAR", Index: 1}}
+	if !reflect.DeepEqual(rev.Before, before) {
+		t.Errorf("Before mismatch. Expected: %v. Got: %v", before, rev.Before)
+	}
+	if !reflect.DeepEqual(rev.After, after) {
+		t.Errorf("After mismatch. Expected: %v. Got: %v", after, rev.After)
+	}
+}
+
+func TestHistoryDoesntRecordFailedChanges(t *testing.T) {
+	srl := New()
+	_ = srl.Delete("FOO")
+	_, _ = srl.Update("FOO", func(*model.Route, []model.Route) error { return nil })
+
+	if hs := srl.History(); len(hs) != 0 {
+		t.Errorf("Unexpected revisions: %v", hs)
+	}
+}
+
+func TestHistoryRecordsTheReloadOfAPowFile(t *testing.T) {
+	srl := New()
+	_ = srl.Reload("/tmp/foo.pow", func() error {
+		srl.Append(model.Route{ID: "FOO", PowFile: "/tmp/foo.pow"})
+		srl.Append(model.Route{ID: "BAR", PowFile: "/tmp/foo.pow"})
+		return nil
+	})
+
+	hs := srl.History()
+	if len(hs) != 1 {
+		t.Fatalf("Expected a single revision. Got: %v", hs)
+	}
+	if hs[0].Operation != "reload" || hs[0].Actor != "/tmp/foo.pow" || len(hs[0].After) != 2 {
+		t.Errorf("Unexpected revision: %v", hs[0])
+	}
+}
+
+func TestHistoryForgetsTheOldestRevisions(t *testing.T) {
+	srl := New()
+	for i := 0; i < HistorySize+5; i++ {
+		srl.Append(model.Route{})
+	}
+
+	hs := srl.History()
+	if len(hs) != HistorySize {
+		t.Fatalf("Expected %d revisions. Got: %d", HistorySize, len(hs))
+	}
+	if hs[0].Version != 6 {
+		t.Errorf("Expected the oldest revision to be 6. Got: %d", hs[0].Version)
+	}
+}
+
+func TestRollbackRestoresTheListAfterTheGivenVersion(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAR"})
+	_ = srl.Delete("FOO")
+
+	if err := srl.Rollback("alice", 2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []model.Route{{ID: "FOO", Index: 0}, {ID: "BAR", Index: 1}}
+	if rs := srl.List(); !reflect.DeepEqual(rs, expected) {
+		t.Errorf("Routes mismatch. Expected: %v. Got: %v", expected, rs)
+	}
+}
+
+func TestRollbackIsRecordedAsANewRevision(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAR"})
+
+	_ = srl.Rollback("alice", 1)
+
+	hs := srl.History()
+	last := hs[len(hs)-1]
+	if last.Version != 3 || last.Operation != "rollback" || last.Actor != "alice" {
+		t.Errorf("Unexpected revision: %v", last)
+	}
+}
+
+func TestRollbackFailsOnUnknownVersion(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	if err := srl.Rollback("", 42); err == nil {
+		t.Error("Expected error not returned")
+	}
+	if rs := srl.List(); len(rs) != 1 {
+		t.Errorf("Routes changed: %v", rs)
+	}
+}
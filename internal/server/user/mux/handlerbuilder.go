@@ -17,40 +17,126 @@
 package mux
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/BBVA/kapow/internal/server/accesslog"
 	"github.com/BBVA/kapow/internal/server/data"
 	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/tracing"
 	"github.com/BBVA/kapow/internal/server/user/spawn"
 )
 
 var spawner = spawn.Spawn
-var idGenerator = uuid.NewUUID
 
-func handlerBuilder(route model.Route) http.Handler {
+// idGenerator generates the handler IDs.  Random UUIDs are used, as the ID
+// is all a process needs to access its request on the data interface.
+var idGenerator = uuid.NewRandom
+
+// secretGenerator generates the handler secrets
+var secretGenerator = newSecret
+
+// newSecret returns a random secret
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func handlerBuilder(route model.Route, config Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, err := idGenerator()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		start := time.Now()
+		rec, ok := w.(*responseRecorder)
+		if !ok {
+			rec = &responseRecorder{ResponseWriter: w}
 		}
-
+		rec.routed = true
 		h := &model.Handler{
-			ID:      id.String(),
 			Route:   route,
 			Request: r,
-			Writer:  w,
+			Writer:  rec,
+			Started: start,
+		}
+		var exit *int
+		span := startRequestSpan(route, r)
+		defer func() {
+			observeRequest(route, rec, start)
+			endRequestSpan(span, h, rec)
+			if config.AccessLog != nil {
+				config.AccessLog.Log(accessLogEntry(h, rec, start, exit))
+			}
+		}()
+
+		id, err := idGenerator()
+		if err != nil {
+			rec.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		h.ID = id.String()
+		if config.HandlerSecrets {
+			if h.Secret, err = secretGenerator(); err != nil {
+				rec.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 		}
 
 		data.Handlers.Add(h)
 		defer data.Handlers.Remove(h.ID)
 
-		err = spawner(h, nil)
+		spawnSpan := tracing.Start("spawn", tracing.KindInternal, span.Context())
+		h.Trace = spawnSpan.Context()
+		err = spawner(h, config.DataURL, nil)
+		if code, ok := exitCode(err); ok {
+			exit = &code
+		}
+		endSpawnSpan(spawnSpan, exit, err)
+		observeProcess(route, exit)
 		if err != nil {
 			log.Println(err)
 		}
+		if h.Cancelled() {
+			// The response is incomplete, so the client connection is
+			// aborted
+			panic(http.ErrAbortHandler)
+		}
 	})
 }
+
+// recordUnmatched records a request that no route has handled, such as the
+// ones answered with a 404 or a 405, with no handler nor route
+func recordUnmatched(r *http.Request, rec *responseRecorder, start time.Time, config Config) {
+	observeRequest(model.Route{}, rec, start)
+	if config.AccessLog != nil {
+		e := accessLogEntry(&model.Handler{Request: r}, rec, start, nil)
+		e.HandlerID, e.RouteID, e.Pattern = "-", "-", "-"
+		config.AccessLog.Log(e)
+	}
+}
+
+// accessLogEntry returns the access log entry of the request handled by h
+func accessLogEntry(h *model.Handler, rec *responseRecorder, start time.Time, exit *int) accesslog.Entry {
+	r := h.Request
+	return accesslog.Entry{
+		Time:       start,
+		RemoteAddr: r.RemoteAddr,
+		HandlerID:  h.ID,
+		RouteID:    h.Route.ID,
+		Pattern:    h.Route.Pattern,
+		Method:     r.Method,
+		Path:       r.RequestURI,
+		Proto:      r.Proto,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		Status:     rec.Status(),
+		Bytes:      rec.bytes,
+		Duration:   time.Since(start),
+		ExitCode:   exit,
+	}
+}
@@ -17,17 +17,24 @@
 package mux
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/BBVA/kapow/internal/server/accesslog"
 	"github.com/BBVA/kapow/internal/server/data"
 	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/tracing"
 	"github.com/BBVA/kapow/internal/server/user/spawn"
 )
 
@@ -35,12 +42,12 @@ func TestHandlerBuilderCallsSpawner(t *testing.T) {
 	route := model.Route{}
 	idGenerator = uuid.NewUUID
 	called := false
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		called = true
 		return nil
 	}
 
-	handlerBuilder(route).ServeHTTP(nil, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(nil, nil)
 
 	if !called {
 		t.Error("Didn't call spawner")
@@ -50,12 +57,12 @@ func TestHandlerBuilderCallsSpawner(t *testing.T) {
 func TestHandlerBuilderStoresHandlerInDataHandlers(t *testing.T) {
 	route := model.Route{}
 	added := false
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		added = len(data.Handlers.ListIDs()) != 0
 
 		return nil
 	}
-	h := handlerBuilder(route)
+	h := handlerBuilder(route, Config{})
 	data.Handlers = data.New()
 
 	h.ServeHTTP(nil, nil)
@@ -71,7 +78,7 @@ func TestHandlerBuilderStoresTheProperRoute(t *testing.T) {
 		ID: "foo",
 	}
 	var got model.Route
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		hid := data.Handlers.ListIDs()[0]
 		handler, _ := data.Handlers.Get(hid)
 		got = handler.Route
@@ -79,7 +86,7 @@ func TestHandlerBuilderStoresTheProperRoute(t *testing.T) {
 		return nil
 	}
 
-	handlerBuilder(route).ServeHTTP(nil, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(nil, nil)
 
 	if !reflect.DeepEqual(got, route) {
 		t.Error("Route not stored properly in the handler")
@@ -90,7 +97,7 @@ func TestHandlerBuilderStoresTheProperRequest(t *testing.T) {
 	data.Handlers = data.New()
 	route := model.Route{}
 	var got *http.Request
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		hid := data.Handlers.ListIDs()[0]
 		handler, _ := data.Handlers.Get(hid)
 		got = handler.Request
@@ -99,7 +106,7 @@ func TestHandlerBuilderStoresTheProperRequest(t *testing.T) {
 	}
 	r := &http.Request{}
 
-	handlerBuilder(route).ServeHTTP(nil, r)
+	handlerBuilder(route, Config{}).ServeHTTP(nil, r)
 
 	if got != r {
 		t.Error("Request not stored properly in the handler")
@@ -110,7 +117,7 @@ func TestHandlerBuilderStoresTheProperResponseWriter(t *testing.T) {
 	data.Handlers = data.New()
 	route := model.Route{}
 	var got http.ResponseWriter
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		hid := data.Handlers.ListIDs()[0]
 		handler, _ := data.Handlers.Get(hid)
 		got = handler.Writer
@@ -120,9 +127,9 @@ func TestHandlerBuilderStoresTheProperResponseWriter(t *testing.T) {
 	w := httptest.NewRecorder()
 	w.Flushed = !w.Flushed
 
-	handlerBuilder(route).ServeHTTP(w, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(w, nil)
 
-	if !reflect.DeepEqual(got, w) {
+	if rec, ok := got.(*responseRecorder); !ok || !reflect.DeepEqual(rec.ResponseWriter, w) {
 		t.Error("ResponseWriter not stored properly in the handler")
 	}
 }
@@ -131,7 +138,7 @@ func TestHandlerBuilderGeneratesAProperID(t *testing.T) {
 	data.Handlers = data.New()
 	route := model.Route{}
 	var got string
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		hid := data.Handlers.ListIDs()[0]
 		handler, _ := data.Handlers.Get(hid)
 		got = handler.ID
@@ -139,7 +146,7 @@ func TestHandlerBuilderGeneratesAProperID(t *testing.T) {
 		return nil
 	}
 
-	handlerBuilder(route).ServeHTTP(nil, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(nil, nil)
 
 	if _, err := uuid.Parse(got); err != nil {
 		t.Error("ID not generated properly")
@@ -151,7 +158,7 @@ func TestHandlerBuilderCallsSpawnerWithTheStoredHandler(t *testing.T) {
 	route := model.Route{}
 	var gotStored *model.Handler
 	var gotPassed *model.Handler
-	spawner = func(h *model.Handler, out io.Writer) error {
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
 		gotPassed = h
 		hid := data.Handlers.ListIDs()[0]
 		gotStored, _ = data.Handlers.Get(hid)
@@ -159,7 +166,7 @@ func TestHandlerBuilderCallsSpawnerWithTheStoredHandler(t *testing.T) {
 		return nil
 	}
 
-	handlerBuilder(route).ServeHTTP(nil, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(nil, nil)
 
 	if gotStored != gotPassed {
 		t.Error("Proper handler not passed to spawner()")
@@ -177,7 +184,7 @@ func TestHandlerBuilder500sWhenIDGeneratorFails(t *testing.T) {
 			"End of Time reached; Try again before, or in the next Big Bang cycle")
 	}
 
-	handlerBuilder(route).ServeHTTP(w, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(w, nil)
 
 	if w.Result().StatusCode != http.StatusInternalServerError {
 		t.Error("ID generation failure not handled gracefully")
@@ -190,9 +197,274 @@ func TestHandlerBuilderRemovesHandlerWhenDone(t *testing.T) {
 	idGenerator = uuid.NewUUID
 	route := model.Route{}
 
-	handlerBuilder(route).ServeHTTP(nil, nil)
+	handlerBuilder(route, Config{}).ServeHTTP(nil, nil)
 
 	if len(data.Handlers.ListIDs()) != 0 {
 		t.Error("Handler not removed upon completion")
 	}
 }
+
+func TestHandlerBuilderRecordsWhenTheHandlerStarted(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	var started time.Time
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		started = h.Started
+		return nil
+	}
+	before := time.Now()
+
+	handlerBuilder(model.Route{}, Config{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if started.Before(before) || started.After(time.Now()) {
+		t.Errorf("Unexpected start time: %v", started)
+	}
+}
+
+func TestHandlerBuilderAbortsTheConnectionWhenCancelled(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		h.Cancel()
+		return errors.New("signal: killed")
+	}
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("Connection not aborted. Got: %v", r)
+		}
+		if data.Handlers.Len() != 0 {
+			t.Error("Handler not removed upon cancellation")
+		}
+	}()
+
+	handlerBuilder(model.Route{}, Config{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestHandlerBuilderPassesTheDataURLToSpawner(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	route := model.Route{}
+	var got string
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		got = dataURL
+
+		return nil
+	}
+
+	handlerBuilder(route, Config{DataURL: "http://localhost:9999"}).ServeHTTP(nil, nil)
+
+	if got != "http://localhost:9999" {
+		t.Errorf(`Data URL mismatch. Expected: "http://localhost:9999". Got: %q`, got)
+	}
+}
+
+func TestHandlerBuilderCountsRequestsByStatus(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	route := model.Route{ID: "metrics-status", Pattern: "/status"}
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		h.Writer.WriteHeader(http.StatusTeapot)
+		return nil
+	}
+
+	handlerBuilder(route, Config{}).ServeHTTP(httptest.NewRecorder(), nil)
+
+	if v := routeRequests.Value("metrics-status", "/status", "418"); v != 1 {
+		t.Errorf("Request count mismatch. Expected: 1. Got: %v", v)
+	}
+	if n := routeDuration.Count("metrics-status", "/status"); n != 1 {
+		t.Errorf("Latency observation count mismatch. Expected: 1. Got: %d", n)
+	}
+}
+
+func TestHandlerBuilderCountsExitCodes(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	route := model.Route{ID: "metrics-exit", Pattern: "/exit", Entrypoint: "/bin/sh -c", Command: "exit 3"}
+	spawner = spawn.Spawn
+
+	handlerBuilder(route, Config{}).ServeHTTP(httptest.NewRecorder(), nil)
+
+	if v := routeProcessExits.Value("metrics-exit", "/exit", "3"); v != 1 {
+		t.Errorf("Exit code count mismatch. Expected: 1. Got: %v", v)
+	}
+	if v := routeSpawnFailures.Value("metrics-exit", "/exit"); v != 0 {
+		t.Errorf("Spawn failure count mismatch. Expected: 0. Got: %v", v)
+	}
+}
+
+func TestHandlerBuilderCountsSpawnFailures(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	route := model.Route{ID: "metrics-spawn", Pattern: "/spawn", Entrypoint: "/nonexistent/entrypoint"}
+	spawner = spawn.Spawn
+
+	handlerBuilder(route, Config{}).ServeHTTP(httptest.NewRecorder(), nil)
+
+	if v := routeSpawnFailures.Value("metrics-spawn", "/spawn"); v != 1 {
+		t.Errorf("Spawn failure count mismatch. Expected: 1. Got: %v", v)
+	}
+}
+
+func TestHandlerBuilderWritesAnAccessLogEntry(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-accesslog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+	l, err := accesslog.New(path, accesslog.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	route := model.Route{ID: "ROUTE", Pattern: "/hello/{name}"}
+	var handlerID string
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		handlerID = h.ID
+		h.Writer.WriteHeader(http.StatusCreated)
+		_, _ = h.Writer.Write([]byte("Hello"))
+		return nil
+	}
+
+	handlerBuilder(route, Config{AccessLog: l}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hello/world", nil))
+
+	b, _ := ioutil.ReadFile(path)
+	var got struct {
+		HandlerID string `json:"handler_id"`
+		RouteID   string `json:"route_id"`
+		Pattern   string `json:"pattern"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		Bytes     int64  `json:"bytes"`
+		ExitCode  *int   `json:"exit_code"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Invalid access log line %q: %v", b, err)
+	}
+	if got.HandlerID != handlerID || got.RouteID != "ROUTE" || got.Pattern != "/hello/{name}" ||
+		got.Method != http.MethodPost || got.Path != "/hello/world" ||
+		got.Status != http.StatusCreated || got.Bytes != 5 ||
+		got.ExitCode == nil || *got.ExitCode != 0 {
+		t.Errorf("Unexpected access log entry: %s", b)
+	}
+}
+
+func TestHandlerBuilderContinuesTheTraceOfTheRequest(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	var got tracing.SpanContext
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		got = h.Trace
+		return nil
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	handlerBuilder(model.Route{}, Config{}).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Trace ID mismatch. Got: %q", got.TraceIDString())
+	}
+	if got.SpanIDString() == "00f067aa0ba902b7" || !got.IsValid() {
+		t.Errorf("Span ID not generated for the process. Got: %q", got.SpanIDString())
+	}
+}
+
+func TestHandlerBuilderStartsATraceWhenTheRequestHasNone(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewUUID
+	var got tracing.SpanContext
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		got = h.Trace
+		return nil
+	}
+
+	handlerBuilder(model.Route{}, Config{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !got.IsValid() {
+		t.Error("Trace not started")
+	}
+}
+
+func TestIDGeneratorIsRandom(t *testing.T) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idGenerator = uuid.NewRandom
+	data.Handlers = data.New()
+	var got string
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		got = h.ID
+		return nil
+	}
+
+	handlerBuilder(model.Route{}, Config{}).ServeHTTP(httptest.NewRecorder(), nil)
+
+	if parsed, err := uuid.Parse(got); err != nil || parsed.Version() != id.Version() {
+		t.Errorf("Handler ID is not a random UUID: %q", got)
+	}
+}
+
+func TestHandlerBuilderGivesASecretToTheHandler(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewRandom
+	var secrets []string
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		secrets = append(secrets, h.Secret)
+		return nil
+	}
+	handler := handlerBuilder(model.Route{}, Config{HandlerSecrets: true})
+
+	handler.ServeHTTP(httptest.NewRecorder(), nil)
+	handler.ServeHTTP(httptest.NewRecorder(), nil)
+
+	if len(secrets) != 2 || len(secrets[0]) != 64 || secrets[0] == secrets[1] {
+		t.Errorf("Unexpected handler secrets: %q", secrets)
+	}
+}
+
+func TestHandlerBuilderDoesntGiveASecretWhenDisabled(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewRandom
+	secret := "unset"
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		secret = h.Secret
+		return nil
+	}
+
+	handlerBuilder(model.Route{}, Config{}).ServeHTTP(httptest.NewRecorder(), nil)
+
+	if secret != "" {
+		t.Errorf("Unexpected handler secret: %q", secret)
+	}
+}
+
+func TestHandlerBuilder500sWhenSecretGeneratorFails(t *testing.T) {
+	data.Handlers = data.New()
+	idGenerator = uuid.NewRandom
+	defer func() { secretGenerator = newSecret }()
+	secretGenerator = func() (string, error) { return "", errors.New("No entropy left") }
+	defer func() { spawner = spawn.Spawn }()
+	spawner = func(h *model.Handler, dataURL string, out io.Writer) error {
+		t.Error("Process spawned without a secret")
+		return nil
+	}
+	w := httptest.NewRecorder()
+
+	handlerBuilder(model.Route{}, Config{HandlerSecrets: true}).ServeHTTP(w, nil)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusInternalServerError, w.Code)
+	}
+}
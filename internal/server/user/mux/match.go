@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// matchedRoute is the handler given to every route when matching, so the
+// matching route can be told apart
+type matchedRoute struct {
+	route model.Route
+}
+
+func (matchedRoute) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+// Match returns the first of rs that would serve req, along with the
+// variables taken from the request path by its url_pattern, without running
+// anything.  The routes are matched as Update would serve them.
+func Match(rs []model.Route, req *http.Request) (model.Route, map[string]string, bool) {
+	m := gorillize(rs, func(r model.Route) http.Handler {
+		return matchedRoute{route: r}
+	})
+
+	var rm mux.RouteMatch
+	if !m.Match(req, &rm) {
+		return model.Route{}, nil, false
+	}
+	matched, ok := rm.Handler.(matchedRoute)
+	if !ok {
+		return model.Route{}, nil, false
+	}
+
+	vars := map[string]string{}
+	for k, v := range rm.Vars {
+		vars[k] = v
+	}
+	return matched.route, vars, true
+}
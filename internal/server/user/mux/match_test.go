@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestMatchReturnsTheFirstMatchingRouteAndItsVariables(t *testing.T) {
+	rs := []model.Route{
+		{ID: "FOO", Method: "POST", Pattern: "/foo/{name}"},
+		{ID: "BAR", Method: "GET", Pattern: "/foo/{name:[a-z]+}"},
+		{ID: "BAZ", Method: "GET", Pattern: "/foo/{name}"},
+	}
+
+	r, vars, ok := Match(rs, httptest.NewRequest("GET", "/foo/bar", nil))
+
+	if !ok {
+		t.Fatal("Route not matched")
+	}
+	if r.ID != "BAR" {
+		t.Errorf("Route mismatch. Expected: BAR. Got: %q", r.ID)
+	}
+	if !reflect.DeepEqual(vars, map[string]string{"name": "bar"}) {
+		t.Errorf("Variables mismatch. Got: %v", vars)
+	}
+}
+
+func TestMatchReturnsEmptyVariablesWhenThePatternHasNone(t *testing.T) {
+	rs := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo"}}
+
+	_, vars, ok := Match(rs, httptest.NewRequest("GET", "/foo", nil))
+
+	if !ok || vars == nil || len(vars) != 0 {
+		t.Errorf("Unexpected match: %v, %v", vars, ok)
+	}
+}
+
+func TestMatchReportsNoMatch(t *testing.T) {
+	rs := []model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo/{id:[0-9]+}"}}
+
+	for _, path := range []string{"/bar", "/foo/bar"} {
+		if r, _, ok := Match(rs, httptest.NewRequest("GET", path, nil)); ok {
+			t.Errorf("%s: Unexpected match: %v", path, r)
+		}
+	}
+	if r, _, ok := Match(rs, httptest.NewRequest("POST", "/foo/1", nil)); ok {
+		t.Errorf("Unexpected match on method mismatch: %v", r)
+	}
+}
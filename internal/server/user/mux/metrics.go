@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/BBVA/kapow/internal/server/metrics"
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+var (
+	routeRequests = metrics.NewCounterVec(
+		"kapow_route_requests_total",
+		"Requests handled by each route, by response status code.",
+		"route_id", "pattern", "status")
+	routeDuration = metrics.NewHistogramVec(
+		"kapow_route_request_duration_seconds",
+		"Time taken to handle the requests of each route.",
+		metrics.DefaultBuckets,
+		"route_id", "pattern")
+	routeSpawnFailures = metrics.NewCounterVec(
+		"kapow_route_spawn_failures_total",
+		"Processes of each route that couldn't be started.",
+		"route_id", "pattern")
+	routeProcessExits = metrics.NewCounterVec(
+		"kapow_route_process_exits_total",
+		"Processes of each route that ran to completion, by exit code.",
+		"route_id", "pattern", "code")
+)
+
+// observeRequest records the outcome of a request to route that started
+// at start
+func observeRequest(route model.Route, rec *responseRecorder, start time.Time) {
+	routeRequests.Inc(route.ID, route.Pattern, strconv.Itoa(rec.Status()))
+	routeDuration.Observe(time.Since(start).Seconds(), route.ID, route.Pattern)
+}
+
+// forgetRemovedRoutes drops the series of the routes not in rs, or whose
+// pattern has changed, so that they don't pile up as routes come and go.
+// The series of the requests not handled by any route are kept.
+func forgetRemovedRoutes(rs []model.Route) {
+	patterns := map[string]string{"": ""}
+	for _, r := range rs {
+		patterns[r.ID] = r.Pattern
+	}
+	keep := func(values []string) bool {
+		p, ok := patterns[values[0]]
+		return ok && p == values[1]
+	}
+	routeRequests.Retain(keep)
+	routeDuration.Retain(keep)
+	routeSpawnFailures.Retain(keep)
+	routeProcessExits.Retain(keep)
+}
+
+// observeProcess records the outcome of running the process of route,
+// given its exit code or nil if it couldn't be run
+func observeProcess(route model.Route, code *int) {
+	if code != nil {
+		routeProcessExits.Inc(route.ID, route.Pattern, strconv.Itoa(*code))
+	} else {
+		routeSpawnFailures.Inc(route.ID, route.Pattern)
+	}
+}
+
+// exitCode returns the exit code of a process given the error returned by
+// the spawner, and false if the process couldn't be run at all.  A process
+// killed by a signal has a -1 exit code.
+func exitCode(err error) (int, bool) {
+	if err == nil {
+		return 0, true
+	}
+	if ee, ok := err.(*exec.ExitError); ok {
+		return ee.ExitCode(), true
+	}
+	return 0, false
+}
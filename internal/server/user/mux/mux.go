@@ -19,20 +19,38 @@ package mux
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/BBVA/kapow/internal/server/accesslog"
 	"github.com/BBVA/kapow/internal/server/model"
 )
 
+// Config holds the server settings needed to serve the user requests
+type Config struct {
+	// DataURL is the URL of the data interface given to the spawned
+	// processes
+	DataURL string
+
+	// AccessLog, when not nil, gets an entry for every served request
+	AccessLog *accesslog.Logger
+
+	// HandlerSecrets makes every handler get a secret that must be
+	// presented on each call to the data interface
+	HandlerSecrets bool
+}
+
 type SwappableMux struct {
-	m    sync.RWMutex
-	root *mux.Router
+	m      sync.RWMutex
+	root   *mux.Router
+	config Config
 }
 
-func New() *SwappableMux {
+func New(config Config) *SwappableMux {
 	return &SwappableMux{
-		root: mux.NewRouter(),
+		root:   mux.NewRouter(),
+		config: config,
 	}
 }
 
@@ -49,10 +67,20 @@ func (sm *SwappableMux) set(mux *mux.Router) {
 	sm.m.Unlock()
 }
 
+// ServeHTTP serves r with the current routes.  The requests not handled by
+// any route are recorded here, as no route handler sees them.
 func (sm *SwappableMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	sm.get().ServeHTTP(w, r)
+	start := time.Now()
+	rec := &responseRecorder{ResponseWriter: w}
+	sm.get().ServeHTTP(rec, r)
+	if !rec.routed {
+		recordUnmatched(r, rec, start, sm.config)
+	}
 }
 
 func (sm *SwappableMux) Update(rs []model.Route) {
-	sm.set(gorillize(rs, handlerBuilder))
+	sm.set(gorillize(rs, func(r model.Route) http.Handler {
+		return handlerBuilder(r, sm.config)
+	}))
+	forgetRemovedRoutes(rs)
 }
@@ -19,19 +19,23 @@
 package mux
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/BBVA/kapow/internal/server/accesslog"
 	"github.com/BBVA/kapow/internal/server/model"
 	"github.com/gorilla/mux"
 )
 
 func TestNewReturnsAProperlyInitializedMux(t *testing.T) {
-	sm := New()
+	sm := New(Config{})
 	sm.root.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusTeapot)
 	})
@@ -227,7 +231,7 @@ func TestServeHTTPCallsInnerMuxAfterAcquiringLock(t *testing.T) {
 }
 
 func TestUpdateUpdatesMuxWithProvideRouteList(t *testing.T) {
-	sm := New()
+	sm := New(Config{})
 	rs := []model.Route{
 		{
 			Method:     "GET",
@@ -252,3 +256,57 @@ func TestUpdateUpdatesMuxWithProvideRouteList(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+func TestUpdateDropsTheMetricsOfRemovedRoutes(t *testing.T) {
+	sm := New(Config{})
+	routeRequests.Inc("kept", "/kept", "200")
+	routeRequests.Inc("moved", "/before", "200")
+	routeRequests.Inc("removed", "/removed", "200")
+
+	sm.Update([]model.Route{
+		{ID: "kept", Method: "GET", Pattern: "/kept", Entrypoint: "/bin/true"},
+		{ID: "moved", Method: "GET", Pattern: "/after", Entrypoint: "/bin/true"},
+	})
+
+	if v := routeRequests.Value("kept", "/kept", "200"); v != 1 {
+		t.Errorf("Request count mismatch for kept route. Expected: 1. Got: %v", v)
+	}
+	if v := routeRequests.Value("moved", "/before", "200"); v != 0 {
+		t.Errorf("Request count mismatch for old pattern. Expected: 0. Got: %v", v)
+	}
+	if v := routeRequests.Value("removed", "/removed", "200"); v != 0 {
+		t.Errorf("Request count mismatch for removed route. Expected: 0. Got: %v", v)
+	}
+}
+
+func TestServeHTTPRecordsTheRequestsNotHandledByAnyRoute(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-accesslog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+	l, err := accesslog.New(path, accesslog.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := New(Config{AccessLog: l})
+	sm.Update([]model.Route{{ID: "FOO", Method: "GET", Pattern: "/foo", Entrypoint: "/bin/true"}})
+	before := routeRequests.Value("", "", "405")
+
+	sm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/foo", nil))
+
+	if v := routeRequests.Value("", "", "405") - before; v != 1 {
+		t.Errorf("Request count mismatch. Expected: 1. Got: %v", v)
+	}
+	b, _ := ioutil.ReadFile(path)
+	var got struct {
+		HandlerID string `json:"handler_id"`
+		RouteID   string `json:"route_id"`
+		Pattern   string `json:"pattern"`
+		Status    int    `json:"status"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Invalid access log line %q: %v", b, err)
+	}
+	if got.HandlerID != "-" || got.RouteID != "-" || got.Pattern != "-" || got.Status != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected access log entry: %s", b)
+	}
+}
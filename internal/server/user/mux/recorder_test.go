@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorderDefaultsTo200(t *testing.T) {
+	rec := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+
+	if s := rec.Status(); s != http.StatusOK {
+		t.Errorf("Status mismatch. Expected: %d. Got: %d", http.StatusOK, s)
+	}
+}
+
+func TestResponseRecorderKeepsTheFirstStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: w}
+
+	rec.WriteHeader(http.StatusNotFound)
+	rec.WriteHeader(http.StatusInternalServerError)
+
+	if s := rec.Status(); s != http.StatusNotFound {
+		t.Errorf("Status mismatch. Expected: %d. Got: %d", http.StatusNotFound, s)
+	}
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status not passed thru. Expected: %d. Got: %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestResponseRecorderCountsTheBytesWritten(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: w}
+
+	_, _ = rec.Write([]byte("Hello "))
+	_, _ = rec.Write([]byte("World"))
+
+	if rec.bytes != 11 {
+		t.Errorf("Size mismatch. Expected: 11. Got: %d", rec.bytes)
+	}
+	if rec.Status() != http.StatusOK {
+		t.Errorf("Status mismatch. Expected: %d. Got: %d", http.StatusOK, rec.Status())
+	}
+	if w.Body.String() != "Hello World" {
+		t.Errorf("Body not passed thru. Got: %q", w.Body.String())
+	}
+}
+
+func TestResponseRecorderFlushesTheWrappedWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: w}
+
+	rec.Flush()
+
+	if !w.Flushed {
+		t.Error("Flush not passed thru")
+	}
+}
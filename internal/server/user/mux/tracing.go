@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"net/http"
+
+	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/tracing"
+)
+
+// startRequestSpan starts the span of a request to route, continuing the
+// trace of the client when the request carries a traceparent header
+func startRequestSpan(route model.Route, r *http.Request) *tracing.Span {
+	span := tracing.Start(route.Method+" "+route.Pattern, tracing.KindServer, tracing.FromRequest(r))
+	span.SetString("http.route", route.Pattern)
+	span.SetString("kapow.route_id", route.ID)
+	if r != nil {
+		span.SetString("http.request.method", r.Method)
+		if r.URL != nil {
+			span.SetString("url.path", r.URL.Path)
+		}
+	}
+	return span
+}
+
+// endRequestSpan finishes the span of the request handled by h
+func endRequestSpan(span *tracing.Span, h *model.Handler, rec *responseRecorder) {
+	status := rec.Status()
+	span.SetString("kapow.handler_id", h.ID)
+	span.SetInt("http.response.status_code", status)
+	if status >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(status))
+	}
+	span.End()
+}
+
+// endSpawnSpan finishes the span of a spawned process given its exit code,
+// or nil if it couldn't be run, and the error returned by the spawner
+func endSpawnSpan(span *tracing.Span, exit *int, err error) {
+	if exit != nil {
+		span.SetInt("process.exit_code", *exit)
+	}
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	span.End()
+}
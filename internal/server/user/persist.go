@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// LoadState returns the routes saved in the state file at path.  A missing
+// state file holds no routes.
+func LoadState(path string) ([]model.Route, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []model.Route{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rs []model.Route
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Persist makes every later change to the route list be saved to the state
+// file at path.  Only the routes not owned by a pow file are saved, since
+// the pow files add theirs again when run.
+func (srl *safeRouteList) Persist(path string) error {
+	srl.saveM.Lock()
+	srl.stateFile = path
+	srl.saveM.Unlock()
+
+	return srl.save()
+}
+
+// save writes the current route list to the state file, if any.  The file
+// is replaced in a single step, so it is never left half written.
+func (srl *safeRouteList) save() error {
+	srl.saveM.Lock()
+	defer srl.saveM.Unlock()
+	if srl.stateFile == "" {
+		return nil
+	}
+
+	rs := []model.Route{}
+	for _, r := range srl.List() {
+		if r.PowFile == "" {
+			rs = append(rs, r)
+		}
+	}
+	b, _ := json.MarshalIndent(rs, "", "  ")
+
+	return writeFileAtomic(srl.stateFile, append(b, '\n'))
+}
+
+// writeFileAtomic writes b to a temporary file next to path and renames it
+// to path
+func writeFileAtomic(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
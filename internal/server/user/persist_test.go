@@ -0,0 +1,110 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestLoadStateReturnsNoRoutesWhenTheFileDoesntExist(t *testing.T) {
+	rs, err := LoadState("/nonexistent/kapow-state.json")
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rs) != 0 {
+		t.Errorf("Unexpected routes: %v", rs)
+	}
+}
+
+func TestLoadStateFailsOnMalformedFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-state")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	_ = ioutil.WriteFile(path, []byte(`[{"id": `), 0600)
+
+	if _, err := LoadState(path); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestPersistSavesTheRoutesOnEveryChange(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-state")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", Method: "GET", Pattern: "/foo"})
+
+	if err := srl.Persist(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srl.Append(model.Route{ID: "BAR", Method: "GET", Pattern: "/bar"})
+	_ = srl.Delete("FOO")
+
+	rs, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []model.Route{{ID: "BAR", Method: "GET", Pattern: "/bar"}}
+	if !reflect.DeepEqual(rs, expected) {
+		t.Errorf("Saved routes mismatch. Expected: %v. Got: %v", expected, rs)
+	}
+}
+
+func TestPersistDoesntSaveTheRoutesOfPowFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-state")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	srl := New()
+	_ = srl.Persist(path)
+
+	srl.Append(model.Route{ID: "FOO", PowFile: "/etc/kapow/foo.pow"})
+	srl.Append(model.Route{ID: "BAR"})
+
+	rs, _ := LoadState(path)
+	if len(rs) != 1 || rs[0].ID != "BAR" {
+		t.Errorf("Unexpected saved routes: %v", rs)
+	}
+}
+
+func TestPersistLeavesNoTemporaryFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kapow-state")
+	defer os.RemoveAll(dir)
+	srl := New()
+	_ = srl.Persist(filepath.Join(dir, "state.json"))
+
+	srl.Append(model.Route{ID: "FOO"})
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "state.json" {
+		t.Errorf("Unexpected files in the state directory: %v", files)
+	}
+}
+
+func TestPersistFailsWhenTheFileCantBeWritten(t *testing.T) {
+	srl := New()
+
+	if err := srl.Persist("/nonexistent/kapow-state.json"); err == nil {
+		t.Error("Expected error not returned")
+	}
+}
@@ -17,24 +17,90 @@
 package user
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/BBVA/kapow/internal/server/user/mux"
 )
 
 // Server is a singleton that stores the http.Server for the user package
 var Server = http.Server{
-	Handler: mux.New(),
+	Handler: mux.New(mux.Config{}),
 }
 
-// Run finishes configuring Server and runs ListenAndServe on it
-func Run(bindAddr string) {
-	Server = http.Server{
-		Addr:    bindAddr,
-		Handler: mux.New(),
+// RedirectServer stores the http.Server that redirects plain HTTP requests
+// to Server when it is served over HTTPS
+var RedirectServer = http.Server{}
+
+// Configure replaces the handler of Server with one built for config,
+// keeping the current routes
+func Configure(config mux.Config) {
+	m := mux.New(config)
+	m.Update(Routes.Snapshot())
+	Server.Handler = m
+}
+
+// Run serves the connections accepted from l on Server.  The routes added
+// before calling Run are kept.
+//
+// It returns nil when the server is shut down.
+func Run(l net.Listener) error {
+	if err := Server.Serve(l); err != http.ErrServerClosed {
+		return fmt.Errorf("UserServer failed: %s", err)
 	}
-	if err := Server.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("UserServer failed: %s", err)
+	return nil
+}
+
+// ConfigureRedirect makes RedirectServer answer every request with a
+// redirection to the same URL over HTTPS on the given port
+func ConfigureRedirect(port string) {
+	RedirectServer.Handler = redirectHandler(port)
+}
+
+// RunRedirect serves the connections accepted from l on RedirectServer
+//
+// It returns nil when the server is shut down.
+func RunRedirect(l net.Listener) error {
+	if err := RedirectServer.Serve(l); err != http.ErrServerClosed {
+		return fmt.Errorf("RedirectServer failed: %s", err)
 	}
+	return nil
+}
+
+// Shutdown stops accepting new connections on Server and RedirectServer
+// and waits for the in-flight requests to finish or ctx to be done
+func Shutdown(ctx context.Context) error {
+	_ = RedirectServer.Shutdown(ctx)
+	return Server.Shutdown(ctx)
+}
+
+// redirectHandler builds a handler that redirects to the requested
+// resource using the https scheme and the given port.  Requests other than
+// GET and HEAD get a 308, so that clients repeat them with the same method
+// and body.
+func redirectHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, u.String(), code)
+	})
 }
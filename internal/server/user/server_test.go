@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHandlerRedirectsToHTTPS(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com/foo?bar=baz", nil)
+
+	redirectHandler("8443").ServeHTTP(w, r)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusMovedPermanently, w.Code)
+	}
+	if l := w.Header().Get("Location"); l != "https://example.com:8443/foo?bar=baz" {
+		t.Errorf(`Location mismatch. Expected: "https://example.com:8443/foo?bar=baz". Got: %q`, l)
+	}
+}
+
+func TestRedirectHandlerKeepsTheMethodOfOtherRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "http://example.com/foo", nil)
+
+	redirectHandler("8443").ServeHTTP(w, r)
+
+	if w.Code != http.StatusPermanentRedirect {
+		t.Errorf("HTTP status mismatch. Expected: %d, got: %d", http.StatusPermanentRedirect, w.Code)
+	}
+}
+
+func TestRedirectHandlerBracketsIPv6Hosts(t *testing.T) {
+	for _, tc := range []struct{ host, port, location string }{
+		{"[::1]", "8443", "https://[::1]:8443/foo"},
+		{"[::1]:8080", "8443", "https://[::1]:8443/foo"},
+		{"[::1]", "443", "https://[::1]/foo"},
+		{"[::1]:8080", "443", "https://[::1]/foo"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		r.Host = tc.host
+
+		redirectHandler(tc.port).ServeHTTP(w, r)
+
+		if l := w.Header().Get("Location"); l != tc.location {
+			t.Errorf("Location mismatch for %q. Expected: %q. Got: %q", tc.host, tc.location, l)
+		}
+	}
+}
+
+func TestRedirectHandlerReplacesTheRequestPort(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com:8080/foo", nil)
+
+	redirectHandler("8443").ServeHTTP(w, r)
+
+	if l := w.Header().Get("Location"); l != "https://example.com:8443/foo" {
+		t.Errorf(`Location mismatch. Expected: "https://example.com:8443/foo". Got: %q`, l)
+	}
+}
+
+func TestRedirectHandlerOmitsTheDefaultHTTPSPort(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com:8080/foo", nil)
+
+	redirectHandler("443").ServeHTTP(w, r)
+
+	if l := w.Header().Get("Location"); l != "https://example.com/foo" {
+		t.Errorf(`Location mismatch. Expected: "https://example.com/foo". Got: %q`, l)
+	}
+}
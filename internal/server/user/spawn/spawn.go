@@ -27,7 +27,21 @@ import (
 	"github.com/BBVA/kapow/internal/server/model"
 )
 
-func Spawn(h *model.Handler, out io.Writer) error {
+// env holds the variables added to the environment of every spawned process
+var env []string
+
+// SetEnv makes every process spawned from now on get the variables in e,
+// given as key=value, besides the ones of the server.  It must be called
+// before serving any request.
+func SetEnv(e []string) {
+	env = e
+}
+
+// Spawn runs the entrypoint and command of the route of h, pointing it to
+// the data interface in dataURL.  The standard output of the process is
+// written to out when not nil.  The process is started in a process group
+// of its own, so it can be killed along with its children by Cancel.
+func Spawn(h *model.Handler, dataURL string, out io.Writer) error {
 	if h.Route.Entrypoint == "" {
 		return errors.New("Entrypoint cannot be empty")
 	}
@@ -44,10 +58,34 @@ func Spawn(h *model.Handler, out io.Writer) error {
 	if out != nil {
 		cmd.Stdout = out
 	}
-	cmd.Env = append(os.Environ(), "KAPOW_DATA_URL=http://localhost:8082")
+	cmd.Env = append(append(os.Environ(), env...), "KAPOW_DATA_URL="+dataURL)
 	cmd.Env = append(cmd.Env, "KAPOW_HANDLER_ID="+h.ID)
+	if h.Secret != "" {
+		cmd.Env = append(cmd.Env, "KAPOW_HANDLER_SECRET="+h.Secret)
+	}
+	if h.Trace.IsValid() {
+		cmd.Env = append(cmd.Env, "TRACEPARENT="+h.Trace.Traceparent())
+		cmd.Env = append(cmd.Env, "KAPOW_TRACE_ID="+h.Trace.TraceIDString())
+	}
+
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if !h.SetProcess(cmd.Process) {
+		_ = killProcessGroup(cmd.Process)
+	}
 
-	err = cmd.Run()
+	err = cmd.Wait()
 
 	return err
 }
+
+// Cancel kills the process group spawned for h, if it has been started,
+// or makes Spawn kill it as soon as it starts otherwise
+func Cancel(h *model.Handler) error {
+	if p := h.Cancel(); p != nil {
+		return killProcessGroup(p)
+	}
+	return nil
+}
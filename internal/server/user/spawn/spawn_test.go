@@ -24,8 +24,10 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/BBVA/kapow/internal/server/model"
+	"github.com/BBVA/kapow/internal/server/tracing"
 )
 
 type Output struct {
@@ -56,7 +58,7 @@ func TestSpawnRetursErrorWhenEntrypointIsBad(t *testing.T) {
 		},
 	}
 
-	err := Spawn(h, nil)
+	err := Spawn(h, "http://localhost:8082", nil)
 
 	if err == nil {
 		t.Error("Bad executable not reported")
@@ -70,7 +72,7 @@ func TestSpawnReturnsNilWhenEntrypointIsGood(t *testing.T) {
 		},
 	}
 
-	err := Spawn(h, nil)
+	err := Spawn(h, "http://localhost:8082", nil)
 
 	if err != nil {
 		t.Error("Good executable reported")
@@ -85,7 +87,7 @@ func TestSpawnWritesToStdout(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "http://localhost:8082", out)
 
 	jldata := decodeJailLover(out.Bytes())
 	if jldata.Cmdline[0] != locateJailLover() {
@@ -101,14 +103,32 @@ func TestSpawnSetsKapowURLEnvVar(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "https://127.0.0.1:9999", out)
 
 	jldata := decodeJailLover(out.Bytes())
-	if v, ok := jldata.Env["KAPOW_DATA_URL"]; !ok || v != "http://localhost:8082" {
+	if v, ok := jldata.Env["KAPOW_DATA_URL"]; !ok || v != "https://127.0.0.1:9999" {
 		t.Error("KAPOW_DATA_URL is not set properly")
 	}
 }
 
+func TestSpawnAddsTheEnvVarsSetWithSetEnv(t *testing.T) {
+	SetEnv([]string{"KAPOW_CAFILE=/etc/kapow/ca.pem"})
+	defer SetEnv(nil)
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: locateJailLover(),
+		},
+	}
+	out := &bytes.Buffer{}
+
+	_ = Spawn(h, "http://localhost:8082", out)
+
+	jldata := decodeJailLover(out.Bytes())
+	if v, ok := jldata.Env["KAPOW_CAFILE"]; !ok || v != "/etc/kapow/ca.pem" {
+		t.Error("KAPOW_CAFILE is not set properly")
+	}
+}
+
 func TestSpawnSetsKapowHandlerIDEnvVar(t *testing.T) {
 	h := &model.Handler{
 		ID: "HANDLER_ID_FOO",
@@ -118,7 +138,7 @@ func TestSpawnSetsKapowHandlerIDEnvVar(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "http://localhost:8082", out)
 
 	jldata := decodeJailLover(out.Bytes())
 	if v, ok := jldata.Env["KAPOW_HANDLER_ID"]; !ok || v != "HANDLER_ID_FOO" {
@@ -126,6 +146,76 @@ func TestSpawnSetsKapowHandlerIDEnvVar(t *testing.T) {
 	}
 }
 
+func TestSpawnSetsKapowHandlerSecretEnvVar(t *testing.T) {
+	h := &model.Handler{
+		Secret: "S3CR3T",
+		Route: model.Route{
+			Entrypoint: locateJailLover(),
+		},
+	}
+	out := &bytes.Buffer{}
+
+	_ = Spawn(h, "http://localhost:8082", out)
+
+	jldata := decodeJailLover(out.Bytes())
+	if v, ok := jldata.Env["KAPOW_HANDLER_SECRET"]; !ok || v != "S3CR3T" {
+		t.Error("KAPOW_HANDLER_SECRET is not set properly")
+	}
+}
+
+func TestSpawnDoesntSetKapowHandlerSecretEnvVarWithoutSecret(t *testing.T) {
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: locateJailLover(),
+		},
+	}
+	out := &bytes.Buffer{}
+
+	_ = Spawn(h, "http://localhost:8082", out)
+
+	jldata := decodeJailLover(out.Bytes())
+	if _, ok := jldata.Env["KAPOW_HANDLER_SECRET"]; ok {
+		t.Error("KAPOW_HANDLER_SECRET set without a secret")
+	}
+}
+
+func TestSpawnSetsTheTraceEnvVars(t *testing.T) {
+	sc, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: locateJailLover(),
+		},
+		Trace: sc,
+	}
+	out := &bytes.Buffer{}
+
+	_ = Spawn(h, "http://localhost:8082", out)
+
+	jldata := decodeJailLover(out.Bytes())
+	if v := jldata.Env["TRACEPARENT"]; v != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("TRACEPARENT is not set properly. Got: %q", v)
+	}
+	if v := jldata.Env["KAPOW_TRACE_ID"]; v != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("KAPOW_TRACE_ID is not set properly. Got: %q", v)
+	}
+}
+
+func TestSpawnDoesntSetTheTraceEnvVarsWithoutTrace(t *testing.T) {
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: locateJailLover(),
+		},
+	}
+	out := &bytes.Buffer{}
+
+	_ = Spawn(h, "http://localhost:8082", out)
+
+	jldata := decodeJailLover(out.Bytes())
+	if _, ok := jldata.Env["KAPOW_TRACE_ID"]; ok {
+		t.Error("KAPOW_TRACE_ID set without a trace")
+	}
+}
+
 func TestSpawnRunsOKEntrypointsWithAParam(t *testing.T) {
 	h := &model.Handler{
 		Route: model.Route{
@@ -134,7 +224,7 @@ func TestSpawnRunsOKEntrypointsWithAParam(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "http://localhost:8082", out)
 
 	jldata := decodeJailLover(out.Bytes())
 	if !reflect.DeepEqual(jldata.Cmdline, []string{locateJailLover(), "-foo"}) {
@@ -150,7 +240,7 @@ func TestSpawnRunsOKEntrypointWithArgWithSpace(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "http://localhost:8082", out)
 
 	jldata := decodeJailLover(out.Bytes())
 	if !reflect.DeepEqual(jldata.Cmdline, []string{locateJailLover(), "foo bar"}) {
@@ -166,7 +256,7 @@ func TestSpawnErrorsWhenEntrypointIsInvalidShell(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	err := Spawn(h, out)
+	err := Spawn(h, "http://localhost:8082", out)
 
 	if err == nil {
 		t.Error("Invalid args not reported")
@@ -181,7 +271,7 @@ func TestSpawnRunsOKEntrypointWithMultipleArgs(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "http://localhost:8082", out)
 
 	jldata := decodeJailLover(out.Bytes())
 	if !reflect.DeepEqual(jldata.Cmdline, []string{locateJailLover(), "foo", "bar"}) {
@@ -198,7 +288,7 @@ func TestSpawnRunsOKEntrypointAndCommand(t *testing.T) {
 	}
 	out := &bytes.Buffer{}
 
-	_ = Spawn(h, out)
+	_ = Spawn(h, "http://localhost:8082", out)
 
 	jldata := decodeJailLover(out.Bytes())
 	if !reflect.DeepEqual(jldata.Cmdline, []string{locateJailLover(), "foo", "bar", "baz qux"}) {
@@ -211,9 +301,71 @@ func TestSpawnReturnsErrorIfEntrypointNotSet(t *testing.T) {
 		Route: model.Route{},
 	}
 
-	err := Spawn(h, nil)
+	err := Spawn(h, "http://localhost:8082", nil)
 
 	if err == nil {
 		t.Error("Spawn() did not report entrypoint not set")
 	}
 }
+
+func TestSpawnRecordsThePIDOfTheProcess(t *testing.T) {
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: locateJailLover(),
+		},
+	}
+
+	_ = Spawn(h, "http://localhost:8082", nil)
+
+	if h.PID() == 0 {
+		t.Error("PID not recorded")
+	}
+}
+
+func TestCancelKillsTheProcessAndItsChildren(t *testing.T) {
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: "/bin/sh -c",
+			Command:    "sleep 30 & wait",
+		},
+	}
+	done := make(chan error)
+	// The child holds the output open, so Spawn only returns once it is
+	// killed too
+	go func() { done <- Spawn(h, "http://localhost:8082", &bytes.Buffer{}) }()
+	for h.PID() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := Cancel(h); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Killed process reported as successful")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Process group not killed")
+	}
+}
+
+func TestCancelBeforeStartKillsTheProcessAsSoonAsItStarts(t *testing.T) {
+	h := &model.Handler{
+		Route: model.Route{
+			Entrypoint: "/bin/sh -c",
+			Command:    "sleep 30",
+		},
+	}
+
+	if err := Cancel(h); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	start := time.Now()
+	err := Spawn(h, "http://localhost:8082", nil)
+
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("Process not killed. Error: %v", err)
+	}
+}
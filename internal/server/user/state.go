@@ -18,6 +18,8 @@ package user
 
 import (
 	"errors"
+	"log"
+	"net/http"
 	"sync"
 
 	"github.com/BBVA/kapow/internal/server/model"
@@ -27,28 +29,142 @@ import (
 type safeRouteList struct {
 	rs []model.Route
 	m  *sync.RWMutex
+
+	// staged holds the routes added by the pow files being reloaded
+	staged map[string][]model.Route
+
+	// powFiles holds the pow files that have been run thru Reload
+	powFiles map[string]bool
+
+	// changeM serializes the changes being served, so that the last one
+	// served is always the current route list
+	changeM *sync.Mutex
+
+	// stateFile is where the routes are saved on every change, if set
+	stateFile string
+	saveM     *sync.Mutex
+
+	// history keeps the last revisions of the list, guarded by m
+	history *history
 }
 
 var Routes safeRouteList = New()
 
 func New() safeRouteList {
 	return safeRouteList{
-		rs: []model.Route{},
-		m:  &sync.RWMutex{},
+		rs:       []model.Route{},
+		m:        &sync.RWMutex{},
+		staged:   map[string][]model.Route{},
+		powFiles: map[string]bool{},
+		changeM:  &sync.Mutex{},
+		saveM:    &sync.Mutex{},
+		history:  &history{},
 	}
 }
 
 func (srl *safeRouteList) Append(r model.Route) model.Route {
+	r, _ = srl.AppendBy("", r, nil)
+	return r
+}
+
+// AppendBy is Append, recording actor as the author of the change in the
+// history.  If check is given it is called as in checkRoute, and nothing is
+// appended if it fails.
+func (srl *safeRouteList) AppendBy(actor string, r model.Route, check func([]model.Route) error) (model.Route, error) {
 	srl.m.Lock()
+	if err := srl.checkRoute(r, check); err != nil {
+		srl.m.Unlock()
+		return model.Route{}, err
+	}
+	if staged, ok := srl.staged[r.PowFile]; ok && r.PowFile != "" {
+		r.Index = powFileIndex(srl.rs, r.PowFile) + len(staged)
+		srl.staged[r.PowFile] = append(staged, r)
+		srl.m.Unlock()
+		return r, nil
+	}
+	before := numbered(srl.rs)
 	r.Index = len(srl.rs)
 	srl.rs = append(srl.rs, r)
+	srl.record("append", actor, before)
 	srl.m.Unlock()
 
-	Server.Handler.(*mux.SwappableMux).Update(srl.Snapshot())
+	srl.changed()
 
+	return r, nil
+}
+
+// checkRoute calls check, if given, with the routes r is going to be served
+// along with: the current ones or, while the pow file of r is being
+// reloaded, the ones it won't replace and the ones already added by it.
+// Must be called with srl.m held.
+func (srl *safeRouteList) checkRoute(r model.Route, check func([]model.Route) error) error {
+	if check == nil {
+		return nil
+	}
+	staged, ok := srl.staged[r.PowFile]
+	if !ok || r.PowFile == "" {
+		return check(numbered(srl.rs))
+	}
+	rs := []model.Route{}
+	for _, o := range srl.rs {
+		if o.PowFile != r.PowFile {
+			rs = append(rs, o)
+		}
+	}
+	return check(numbered(append(rs, staged...)))
+}
+
+// Insert puts r at the given position of the list, moving the following
+// routes one place down.  Indexes past the end of the list append the
+// route.  While the pow file of r is being reloaded, r is staged along with
+// the other routes of the pow file, which are kept together, as close to
+// the given position as they allow.
+func (srl *safeRouteList) Insert(r model.Route, index int) model.Route {
+	r, _ = srl.InsertBy("", r, index, nil)
 	return r
 }
 
+// InsertBy is Insert, recording actor as the author of the change in the
+// history.  If check is given it is called as in checkRoute, and nothing is
+// inserted if it fails.
+func (srl *safeRouteList) InsertBy(actor string, r model.Route, index int, check func([]model.Route) error) (model.Route, error) {
+	srl.m.Lock()
+	if err := srl.checkRoute(r, check); err != nil {
+		srl.m.Unlock()
+		return model.Route{}, err
+	}
+	if staged, ok := srl.staged[r.PowFile]; ok && r.PowFile != "" {
+		first := powFileIndex(srl.rs, r.PowFile)
+		i := index - first
+		if i < 0 {
+			i = 0
+		} else if i > len(staged) {
+			i = len(staged)
+		}
+		r.Index = first + i
+		staged = append(staged, model.Route{})
+		copy(staged[i+1:], staged[i:])
+		staged[i] = r
+		srl.staged[r.PowFile] = staged
+		srl.m.Unlock()
+		return r, nil
+	}
+	before := numbered(srl.rs)
+	if index > len(srl.rs) {
+		index = len(srl.rs)
+	}
+	r.Index = index
+	srl.rs = append(srl.rs, model.Route{})
+	copy(srl.rs[index+1:], srl.rs[index:])
+	srl.rs[index] = r
+	srl.record("insert", actor, before)
+	srl.m.Unlock()
+
+	srl.changed()
+
+	return r, nil
+}
+
 func (srl *safeRouteList) Snapshot() []model.Route {
 	srl.m.RLock()
 	defer srl.m.RUnlock()
@@ -66,14 +182,29 @@ func (srl *safeRouteList) List() []model.Route {
 	return rs
 }
 
+// Len returns the number of routes being served
+func (srl *safeRouteList) Len() int {
+	srl.m.RLock()
+	defer srl.m.RUnlock()
+	return len(srl.rs)
+}
+
 func (srl *safeRouteList) Delete(ID string) error {
+	return srl.DeleteBy("", ID)
+}
+
+// DeleteBy is Delete, recording actor as the author of the change in the
+// history
+func (srl *safeRouteList) DeleteBy(actor, ID string) error {
 	// TODO: Refactor with `defer` if applicable
 	srl.m.Lock()
 	for i := 0; i < len(srl.rs); i++ {
 		if srl.rs[i].ID == ID {
+			before := numbered(srl.rs)
 			srl.rs = append(srl.rs[:i], srl.rs[i+1:]...)
+			srl.record("delete", actor, before)
 			srl.m.Unlock()
-			Server.Handler.(*mux.SwappableMux).Update(srl.Snapshot())
+			srl.changed()
 			return nil
 
 		}
@@ -82,6 +213,161 @@ func (srl *safeRouteList) Delete(ID string) error {
 	return errors.New("Route not found")
 }
 
+// Update changes the route with the given ID in place by calling update on a
+// copy of it, along with the routes it is served with as in checkRoute.  The
+// ID and position of the route are kept, and the new version is served from
+// the next request on.  Nothing is changed if update fails.
+func (srl *safeRouteList) Update(ID string, update func(*model.Route, []model.Route) error) (model.Route, error) {
+	return srl.UpdateBy("", ID, update)
+}
+
+// UpdateBy is Update, recording actor as the author of the change in the
+// history
+func (srl *safeRouteList) UpdateBy(actor, ID string, update func(*model.Route, []model.Route) error) (model.Route, error) {
+	srl.m.Lock()
+	for i := 0; i < len(srl.rs); i++ {
+		if srl.rs[i].ID == ID {
+			r := srl.rs[i]
+			err := srl.checkRoute(r, func(rs []model.Route) error {
+				return update(&r, rs)
+			})
+			if err != nil {
+				srl.m.Unlock()
+				return model.Route{}, err
+			}
+			before := numbered(srl.rs)
+			r.ID, r.Index = ID, i
+			srl.rs[i] = r
+			srl.record("update", actor, before)
+			srl.m.Unlock()
+			srl.changed()
+			return r, nil
+		}
+	}
+	srl.m.Unlock()
+	return model.Route{}, errors.New("Route not found")
+}
+
+// ReplaceAll replaces the whole route list with rs in a single step.  The
+// routes are owned by pow files as told by owned.
+func (srl *safeRouteList) ReplaceAll(rs []model.Route) {
+	_ = srl.ReplaceAllBy("", rs, nil)
+}
+
+// ReplaceAllBy is ReplaceAll, recording actor as the author of the change in
+// the history.  If check is given it is called with the current routes, and
+// nothing is replaced if it fails.
+func (srl *safeRouteList) ReplaceAllBy(actor string, rs []model.Route, check func([]model.Route) error) error {
+	srl.m.Lock()
+	before := numbered(srl.rs)
+	if check != nil {
+		if err := check(before); err != nil {
+			srl.m.Unlock()
+			return err
+		}
+	}
+	srl.rs = srl.owned(rs)
+	srl.record("replace_all", actor, before)
+	srl.m.Unlock()
+
+	srl.changed()
+
+	return nil
+}
+
+// Merge replaces in place the routes with the same ID as the ones in rs,
+// and appends the rest, in a single step.  The routes are owned by pow
+// files as told by owned.
+func (srl *safeRouteList) Merge(rs []model.Route) {
+	_ = srl.MergeBy("", rs, nil)
+}
+
+// MergeBy is Merge, recording actor as the author of the change in the
+// history.  If check is given it is called with the current routes, and
+// nothing is merged if it fails.
+func (srl *safeRouteList) MergeBy(actor string, rs []model.Route, check func([]model.Route) error) error {
+	srl.m.Lock()
+	before := numbered(srl.rs)
+	if check != nil {
+		if err := check(before); err != nil {
+			srl.m.Unlock()
+			return err
+		}
+	}
+	for _, r := range srl.owned(rs) {
+		i := 0
+		for i < len(srl.rs) && srl.rs[i].ID != r.ID {
+			i++
+		}
+		if i < len(srl.rs) {
+			srl.rs[i] = r
+		} else {
+			srl.rs = append(srl.rs, r)
+		}
+	}
+	srl.record("merge", actor, before)
+	srl.m.Unlock()
+
+	srl.changed()
+
+	return nil
+}
+
+// owned returns a copy of rs where every route is owned by the pow file of
+// the current route with its ID, if any, or else by the pow file it names
+// if it is one the server runs, so that the pow file replaces it when
+// reloaded.  The rest are owned by none.  Must be called with srl.m held.
+func (srl *safeRouteList) owned(rs []model.Route) []model.Route {
+	owners := map[string]string{}
+	running := map[string]bool{}
+	for p := range srl.powFiles {
+		running[p] = true
+	}
+	for _, r := range srl.rs {
+		owners[r.ID] = r.PowFile
+		if r.PowFile != "" {
+			running[r.PowFile] = true
+		}
+	}
+
+	owned := make([]model.Route, len(rs))
+	for i, r := range rs {
+		if p, ok := owners[r.ID]; ok {
+			r.PowFile = p
+		} else if !running[r.PowFile] {
+			r.PowFile = ""
+		}
+		owned[i] = r
+	}
+	return owned
+}
+
+// Batch replaces the route list with the result of calling apply on a copy
+// of it, in a single step, and returns the new list.  Nothing is changed if
+// apply fails.
+func (srl *safeRouteList) Batch(apply func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+	return srl.BatchBy("", apply)
+}
+
+// BatchBy is Batch, recording actor as the author of the change in the
+// history
+func (srl *safeRouteList) BatchBy(actor string, apply func([]model.Route) ([]model.Route, error)) ([]model.Route, error) {
+	srl.m.Lock()
+	before := numbered(srl.rs)
+	rs, err := apply(numbered(srl.rs))
+	if err != nil {
+		srl.m.Unlock()
+		return nil, err
+	}
+	srl.rs = numbered(rs)
+	srl.record("batch", actor, before)
+	srl.m.Unlock()
+
+	srl.changed()
+
+	return numbered(rs), nil
+}
+
 func (srl *safeRouteList) Get(ID string) (r model.Route, err error) {
 	srl.m.RLock()
 	defer srl.m.RUnlock()
@@ -94,3 +380,75 @@ func (srl *safeRouteList) Get(ID string) (r model.Route, err error) {
 	err = errors.New("Route not found")
 	return
 }
+
+// Match returns the route that would serve req, along with the variables
+// taken from its path, without running it
+func (srl *safeRouteList) Match(req *http.Request) (model.Route, map[string]string, bool) {
+	return mux.Match(srl.List(), req)
+}
+
+// Reload runs load and replaces the routes of powFile with the ones
+// appended for it meanwhile, in a single step and in the position of the
+// replaced ones.  If load fails the appended routes are discarded and the
+// previous ones are kept.
+func (srl *safeRouteList) Reload(powFile string, load func() error) error {
+	srl.m.Lock()
+	if _, ok := srl.staged[powFile]; ok {
+		srl.m.Unlock()
+		return errors.New("Pow file already being loaded")
+	}
+	srl.staged[powFile] = []model.Route{}
+	srl.powFiles[powFile] = true
+	srl.m.Unlock()
+
+	err := load()
+
+	srl.m.Lock()
+	staged := srl.staged[powFile]
+	delete(srl.staged, powFile)
+	if err != nil {
+		srl.m.Unlock()
+		return err
+	}
+	before := numbered(srl.rs)
+	i := powFileIndex(srl.rs, powFile)
+	rs := make([]model.Route, 0, len(srl.rs)+len(staged))
+	for _, r := range srl.rs {
+		if r.PowFile != powFile {
+			rs = append(rs, r)
+		}
+	}
+	srl.rs = append(rs[:i], append(staged, rs[i:]...)...)
+	srl.record("reload", powFile, before)
+	srl.m.Unlock()
+
+	srl.changed()
+
+	return nil
+}
+
+// changed serves the current route list and saves it to the state file.
+// Saving errors are only logged, as the change is already being served.
+// The list is read once the changes made before are being served, so a
+// change made meanwhile is never replaced by an older list.
+func (srl *safeRouteList) changed() {
+	srl.changeM.Lock()
+	defer srl.changeM.Unlock()
+
+	Server.Handler.(*mux.SwappableMux).Update(srl.Snapshot())
+
+	if err := srl.save(); err != nil {
+		log.Printf("Saving the routes failed: %s", err)
+	}
+}
+
+// powFileIndex returns the position of the first route of powFile in rs, or
+// the end of the list if it has none
+func powFileIndex(rs []model.Route, powFile string) int {
+	for i, r := range rs {
+		if r.PowFile == powFile {
+			return i
+		}
+	}
+	return len(rs)
+}
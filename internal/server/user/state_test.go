@@ -19,10 +19,13 @@
 package user
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -76,6 +79,16 @@ func TestAppendAddsRouteAfterMutexIsReleased(t *testing.T) {
 	}
 }
 
+func TestLenReturnsTheNumberOfRoutes(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAR"})
+
+	if n := srl.Len(); n != 2 {
+		t.Errorf("Route count mismatch. Expected: 2. Got: %d", n)
+	}
+}
+
 func TestSnapshotReturnTheCurrentListOfRoutes(t *testing.T) {
 	srl := New()
 	srl.Append(model.Route{ID: "FOO"})
@@ -196,6 +209,85 @@ func TestAppendReturnsTheInsertedRoutedWithTheActualIndexWhenPopulated(t *testin
 	}
 }
 
+func TestInsertPutsTheRouteInTheGivenPosition(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAZ"})
+
+	r := srl.Insert(model.Route{ID: "BAR"}, 1)
+
+	if r.Index != 1 {
+		t.Errorf("Index of the returned route is not 1, but %d", r.Index)
+	}
+	ids := []string{}
+	for _, r := range srl.List() {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"FOO", "BAR", "BAZ"}) {
+		t.Errorf("Unexpected route order: %v", ids)
+	}
+}
+
+func TestInsertPutsTheRouteFirstWithIndexZero(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	srl.Insert(model.Route{ID: "BAR"}, 0)
+
+	if srl.rs[0].ID != "BAR" || srl.rs[1].ID != "FOO" {
+		t.Errorf("Unexpected route order: %v", srl.rs)
+	}
+}
+
+func TestInsertAppendsTheRouteWhenIndexIsPastTheEnd(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	r := srl.Insert(model.Route{ID: "BAR"}, 42)
+
+	if r.Index != 1 {
+		t.Errorf("Index of the returned route is not 1, but %d", r.Index)
+	}
+	if len(srl.rs) != 2 || srl.rs[1].ID != "BAR" {
+		t.Errorf("Unexpected route list: %v", srl.rs)
+	}
+}
+
+func TestAppendByChecksTheRouteAgainstTheCurrentRoutes(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	var checked []model.Route
+
+	_, err := srl.AppendBy("", model.Route{ID: "BAR"}, func(rs []model.Route) error {
+		checked = rs
+		return errors.New("clash")
+	})
+
+	if err == nil || err.Error() != "clash" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(checked) != 1 || checked[0].ID != "FOO" {
+		t.Errorf("Unexpected checked routes: %v", checked)
+	}
+	if len(srl.rs) != 1 {
+		t.Errorf("Route appended despite the failed check: %v", srl.rs)
+	}
+}
+
+func TestInsertByDoesntInsertWhenTheCheckFails(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	_, err := srl.InsertBy("", model.Route{ID: "BAR"}, 0, func([]model.Route) error { return errors.New("clash") })
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if len(srl.rs) != 1 || srl.rs[0].ID != "FOO" {
+		t.Errorf("Route inserted despite the failed check: %v", srl.rs)
+	}
+}
+
 func TestListReturnsTheSameNumberOfRoutesThanSnapshot(t *testing.T) {
 	srl := New()
 	srl.Append(model.Route{ID: "FOO"})
@@ -310,7 +402,7 @@ func TestPackageHaveASingletonEmptyRouteList(t *testing.T) {
 
 func TestAppendUpdatesMuxWithProvideRoute(t *testing.T) {
 	Server = http.Server{
-		Handler: mux.New(),
+		Handler: mux.New(mux.Config{}),
 	}
 	srl := New()
 	route := model.Route{
@@ -336,9 +428,34 @@ func TestAppendUpdatesMuxWithProvideRoute(t *testing.T) {
 	}
 }
 
+func TestConcurrentChangesServeTheWholeList(t *testing.T) {
+	Server = http.Server{
+		Handler: mux.New(mux.Config{}),
+	}
+	srl := New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			srl.Append(model.Route{Method: "GET", Pattern: fmt.Sprintf("/r%d", i), Entrypoint: "/bin/true"})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		Server.Handler.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/r%d", i), nil))
+		if w.Code == http.StatusNotFound {
+			t.Errorf("Route /r%d not served", i)
+		}
+	}
+}
+
 func TestDeleteUpdatesMuxWithRemainingRoutes(t *testing.T) {
 	Server = http.Server{
-		Handler: mux.New(),
+		Handler: mux.New(mux.Config{}),
 	}
 	srl := New()
 	route := srl.Append(
@@ -366,6 +483,223 @@ func TestDeleteUpdatesMuxWithRemainingRoutes(t *testing.T) {
 	}
 }
 
+func TestUpdateReturnsAnErrorWhenRouteNotExists(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	_, err := srl.Update("BAR", func(*model.Route, []model.Route) error { return nil })
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+}
+
+func TestUpdateChangesTheRouteKeepingIDAndIndex(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", Command: "foo"})
+	srl.Append(model.Route{ID: "BAR", Command: "bar"})
+	srl.Append(model.Route{ID: "BAZ", Command: "baz"})
+
+	r, err := srl.Update("BAR", func(r *model.Route, _ []model.Route) error {
+		*r = model.Route{ID: "QUX", Command: "qux", Index: 42}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := model.Route{ID: "BAR", Command: "qux", Index: 1}
+	if r != expected {
+		t.Errorf("Unexpected route. Expected: %v. Got: %v", expected, r)
+	}
+	if !reflect.DeepEqual(srl.List()[1], expected) || len(srl.rs) != 3 {
+		t.Errorf("Unexpected route list: %v", srl.rs)
+	}
+}
+
+func TestUpdateGivesTheRoutesItIsServedWith(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", PowFile: "/etc/kapow/foo.pow"})
+	srl.Append(model.Route{ID: "BAR"})
+	var got []string
+
+	_ = srl.Reload("/etc/kapow/foo.pow", func() error {
+		srl.Append(model.Route{ID: "BAZ", PowFile: "/etc/kapow/foo.pow"})
+		_, _ = srl.Update("FOO", func(_ *model.Route, rs []model.Route) error {
+			for _, r := range rs {
+				got = append(got, r.ID)
+			}
+			return nil
+		})
+		return nil
+	})
+
+	expected := []string{"BAR", "BAZ"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected routes. Expected: %v. Got: %v", expected, got)
+	}
+}
+
+func TestUpdateLeavesTheRouteUntouchedWhenUpdateFails(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", Command: "foo"})
+
+	_, err := srl.Update("FOO", func(r *model.Route, _ []model.Route) error {
+		r.Command = "bar"
+		return errors.New("Invalid route")
+	})
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if srl.rs[0].Command != "foo" {
+		t.Errorf("Route changed: %v", srl.rs[0])
+	}
+}
+
+func TestReplaceAllReplacesTheWholeList(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	rs := []model.Route{{ID: "BAR"}, {ID: "BAZ"}}
+
+	srl.ReplaceAll(rs)
+	rs[0].ID = "QUX"
+
+	if len(srl.rs) != 2 || srl.rs[0].ID != "BAR" || srl.rs[1].ID != "BAZ" {
+		t.Errorf("Unexpected route list: %v", srl.rs)
+	}
+}
+
+func TestMergeReplacesKnownRoutesInPlaceAndAppendsTheRest(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", Command: "foo"})
+	srl.Append(model.Route{ID: "BAR", Command: "bar"})
+
+	srl.Merge([]model.Route{{ID: "BAZ", Command: "baz"}, {ID: "FOO", Command: "new foo"}})
+
+	expected := []model.Route{
+		{ID: "FOO", Command: "new foo"},
+		{ID: "BAR", Command: "bar", Index: 1},
+		{ID: "BAZ", Command: "baz", Index: 2},
+	}
+	if rs := srl.List(); !reflect.DeepEqual(rs, expected) {
+		t.Errorf("Unexpected route list. Expected: %v. Got: %v", expected, rs)
+	}
+}
+
+func TestMergeKeepsThePowFileOfTheReplacedRoutes(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", PowFile: "/etc/kapow/foo.pow"})
+
+	srl.Merge([]model.Route{{ID: "FOO", Command: "new foo"}})
+
+	if srl.rs[0].PowFile != "/etc/kapow/foo.pow" {
+		t.Errorf("Pow file mismatch. Expected: %q. Got: %q", "/etc/kapow/foo.pow", srl.rs[0].PowFile)
+	}
+}
+
+func TestImportedRoutesAreOwnedOnlyByThePowFilesBeingRun(t *testing.T) {
+	srl := New()
+	_ = srl.Reload("/etc/kapow/empty.pow", func() error { return nil })
+	srl.Append(model.Route{ID: "FOO", PowFile: "/etc/kapow/foo.pow"})
+
+	srl.Merge([]model.Route{
+		{ID: "BAR", PowFile: "/etc/kapow/foo.pow"},
+		{ID: "BAZ", PowFile: "/etc/kapow/empty.pow"},
+		{ID: "QUX", PowFile: "/etc/kapow/gone.pow"},
+	})
+
+	expected := []string{"/etc/kapow/foo.pow", "/etc/kapow/foo.pow", "/etc/kapow/empty.pow", ""}
+	for i, r := range srl.rs {
+		if r.PowFile != expected[i] {
+			t.Errorf("Pow file mismatch for %q. Expected: %q. Got: %q", r.ID, expected[i], r.PowFile)
+		}
+	}
+}
+
+func TestReplaceAllKeepsThePowFileOfTheRoutesWithTheSameID(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", PowFile: "/etc/kapow/foo.pow"})
+
+	srl.ReplaceAll([]model.Route{{ID: "FOO"}, {ID: "BAR", PowFile: "/etc/kapow/gone.pow"}})
+
+	if srl.rs[0].PowFile != "/etc/kapow/foo.pow" || srl.rs[1].PowFile != "" {
+		t.Errorf("Unexpected route list: %v", srl.rs)
+	}
+}
+
+func TestMergeByLeavesTheListUntouchedWhenTheCheckFails(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", Command: "foo"})
+	var checked []model.Route
+
+	err := srl.MergeBy("", []model.Route{{ID: "FOO", Command: "new foo"}}, func(rs []model.Route) error {
+		checked = rs
+		return errors.New("clash")
+	})
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if len(checked) != 1 || checked[0].ID != "FOO" {
+		t.Errorf("Unexpected checked routes: %v", checked)
+	}
+	if srl.rs[0].Command != "foo" {
+		t.Errorf("Route changed: %v", srl.rs[0])
+	}
+}
+
+func TestReplaceAllByLeavesTheListUntouchedWhenTheCheckFails(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	err := srl.ReplaceAllBy("", []model.Route{}, func([]model.Route) error { return errors.New("clash") })
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if len(srl.rs) != 1 {
+		t.Errorf("Unexpected route list: %v", srl.rs)
+	}
+}
+
+func TestBatchReplacesTheListWithTheResultOfApply(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	rs, err := srl.Batch(func(rs []model.Route) ([]model.Route, error) {
+		return append([]model.Route{{ID: "BAR"}}, rs...), nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []model.Route{{ID: "BAR"}, {ID: "FOO", Index: 1}}
+	if !reflect.DeepEqual(rs, expected) {
+		t.Errorf("Unexpected returned list. Expected: %v. Got: %v", expected, rs)
+	}
+	if !reflect.DeepEqual(srl.List(), expected) {
+		t.Errorf("Unexpected route list. Expected: %v. Got: %v", expected, srl.List())
+	}
+}
+
+func TestBatchLeavesTheListUntouchedWhenApplyFails(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+
+	_, err := srl.Batch(func(rs []model.Route) ([]model.Route, error) {
+		rs[0].ID = "BAR"
+		return nil, errors.New("invalid")
+	})
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if len(srl.rs) != 1 || srl.rs[0].ID != "FOO" {
+		t.Errorf("Unexpected route list: %v", srl.rs)
+	}
+}
+
 func TestGetReturnsAnErrorWhenEmptyList(t *testing.T) {
 	srl := New()
 
@@ -431,3 +765,154 @@ func TestGetNonBlockingReadWithOtherReaders(t *testing.T) {
 		t.Error("Route list couldn't be readed while mutex was acquired for read")
 	}
 }
+
+func TestAppendStagesTheRoutesOfAPowFileBeingReloaded(t *testing.T) {
+	srl := New()
+	srl.staged["foo.pow"] = []model.Route{}
+
+	srl.Append(model.Route{ID: "FOO", PowFile: "foo.pow"})
+
+	if len(srl.rs) != 0 {
+		t.Error("Route added to the list while its pow file was being reloaded")
+	}
+	if len(srl.staged["foo.pow"]) != 1 {
+		t.Error("Route not staged")
+	}
+}
+
+func TestAppendByChecksAStagedRouteAgainstTheRoutesKeptAndStaged(t *testing.T) {
+	srl := New()
+	srl.rs = []model.Route{{ID: "FOO"}, {ID: "OLD", PowFile: "foo.pow"}}
+	srl.staged["foo.pow"] = []model.Route{{ID: "NEW", PowFile: "foo.pow"}}
+	var checked []string
+
+	_, _ = srl.AppendBy("", model.Route{ID: "BAR", PowFile: "foo.pow"}, func(rs []model.Route) error {
+		for _, r := range rs {
+			checked = append(checked, r.ID)
+		}
+		return nil
+	})
+
+	if !reflect.DeepEqual(checked, []string{"FOO", "NEW"}) {
+		t.Errorf("Unexpected checked routes: %v", checked)
+	}
+}
+
+func TestInsertStagesTheRoutesOfAPowFileBeingReloadedAmongThem(t *testing.T) {
+	srl := New()
+	srl.rs = []model.Route{{ID: "FOO"}, {ID: "OLD", PowFile: "foo.pow"}}
+	srl.staged["foo.pow"] = []model.Route{{ID: "NEW1", PowFile: "foo.pow"}, {ID: "NEW2", PowFile: "foo.pow"}}
+
+	first := srl.Insert(model.Route{ID: "FIRST", PowFile: "foo.pow"}, 0)
+	second := srl.Insert(model.Route{ID: "SECOND", PowFile: "foo.pow"}, 3)
+
+	if len(srl.rs) != 2 {
+		t.Error("Route inserted in the list while its pow file was being reloaded")
+	}
+	ids := []string{}
+	for _, r := range srl.staged["foo.pow"] {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"FIRST", "NEW1", "SECOND", "NEW2"}) {
+		t.Errorf("Routes not properly staged. Got: %v", ids)
+	}
+	if first.Index != 1 || second.Index != 3 {
+		t.Errorf("Index mismatch. Expected: 1 and 3. Got: %d and %d", first.Index, second.Index)
+	}
+}
+
+func TestReloadReplacesTheRoutesOfThePowFileInPlace(t *testing.T) {
+	Server = http.Server{
+		Handler: mux.New(mux.Config{}),
+	}
+	srl := New()
+	srl.rs = []model.Route{
+		{ID: "FOO"},
+		{ID: "OLD1", PowFile: "foo.pow"},
+		{ID: "BAR", PowFile: "bar.pow"},
+		{ID: "OLD2", PowFile: "foo.pow"},
+	}
+
+	err := srl.Reload("foo.pow", func() error {
+		srl.Append(model.Route{ID: "NEW1", PowFile: "foo.pow"})
+		srl.Append(model.Route{ID: "NEW2", PowFile: "foo.pow"})
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ids := []string{}
+	for _, r := range srl.rs {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"FOO", "NEW1", "NEW2", "BAR"}) {
+		t.Errorf("Routes not properly replaced. Got: %v", ids)
+	}
+}
+
+func TestReloadAppendsTheRoutesOfANewPowFile(t *testing.T) {
+	Server = http.Server{
+		Handler: mux.New(mux.Config{}),
+	}
+	srl := New()
+	srl.rs = []model.Route{{ID: "FOO"}}
+
+	_ = srl.Reload("foo.pow", func() error {
+		srl.Append(model.Route{ID: "NEW", PowFile: "foo.pow"})
+		return nil
+	})
+
+	if len(srl.rs) != 2 || srl.rs[1].ID != "NEW" {
+		t.Errorf("Route not appended. Got: %v", srl.rs)
+	}
+}
+
+func TestReloadKeepsThePreviousRoutesWhenLoadFails(t *testing.T) {
+	srl := New()
+	srl.rs = []model.Route{{ID: "OLD", PowFile: "foo.pow"}}
+
+	err := srl.Reload("foo.pow", func() error {
+		srl.Append(model.Route{ID: "NEW", PowFile: "foo.pow"})
+		return errors.New("pow file failed")
+	})
+
+	if err == nil {
+		t.Error("Expected error not returned")
+	}
+	if len(srl.rs) != 1 || srl.rs[0].ID != "OLD" {
+		t.Errorf("Previous routes not kept. Got: %v", srl.rs)
+	}
+	if _, ok := srl.staged["foo.pow"]; ok {
+		t.Error("Staged routes not discarded")
+	}
+}
+
+func TestReloadLeavesRoutesAddedByHandUntouched(t *testing.T) {
+	Server = http.Server{
+		Handler: mux.New(mux.Config{}),
+	}
+	srl := New()
+	srl.rs = []model.Route{{ID: "OLD", PowFile: "foo.pow"}}
+
+	_ = srl.Reload("foo.pow", func() error {
+		srl.Append(model.Route{ID: "HAND"})
+		return nil
+	})
+
+	if len(srl.rs) != 1 || srl.rs[0].ID != "HAND" {
+		t.Errorf("Route added by hand not kept. Got: %v", srl.rs)
+	}
+}
+
+func TestMatchReturnsTheRouteWithItsIndex(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO", Method: "GET", Pattern: "/foo"})
+	srl.Append(model.Route{ID: "BAR", Method: "GET", Pattern: "/bar/{name}"})
+
+	r, vars, ok := srl.Match(httptest.NewRequest("GET", "/bar/baz", nil))
+
+	if !ok || r.ID != "BAR" || r.Index != 1 || vars["name"] != "baz" {
+		t.Errorf("Unexpected match: %v, %v, %v", r, vars, ok)
+	}
+}
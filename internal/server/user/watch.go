@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+// watchBuffer is the number of revisions a watcher can fall behind before
+// being dropped
+const watchBuffer = 64
+
+// Watch returns the current version of the route list and the list itself,
+// along with a channel receiving every later revision in order.  The
+// channel is closed when stop is called, or when the watcher falls too far
+// behind, so it never slows down the changes.
+func (srl *safeRouteList) Watch() (version int, rs []model.Route, revisions <-chan Revision, stop func()) {
+	c := make(chan Revision, watchBuffer)
+
+	srl.m.Lock()
+	defer srl.m.Unlock()
+	if srl.history.watchers == nil {
+		srl.history.watchers = map[chan Revision]bool{}
+	}
+	srl.history.watchers[c] = true
+
+	stop = func() {
+		srl.m.Lock()
+		defer srl.m.Unlock()
+		srl.history.unwatch(c)
+	}
+	return srl.history.last, numbered(srl.rs), c, stop
+}
+
+// notify sends rev to every watcher, dropping the ones whose buffer is full.
+// It must be called with the route list locked.
+func (h *history) notify(rev Revision) {
+	for c := range h.watchers {
+		select {
+		case c <- rev:
+		default:
+			h.unwatch(c)
+		}
+	}
+}
+
+// unwatch closes c and stops sending revisions to it, if it hasn't been
+// done yet
+func (h *history) unwatch(c chan Revision) {
+	if h.watchers[c] {
+		delete(h.watchers, c)
+		close(c)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Banco Bilbao Vizcaya Argentaria, S.A.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package user
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BBVA/kapow/internal/server/model"
+)
+
+func TestWatchReturnsTheCurrentVersionAndRoutes(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	srl.Append(model.Route{ID: "BAR"})
+
+	version, rs, _, stop := srl.Watch()
+	defer stop()
+
+	if version != 2 {
+		t.Errorf("Version mismatch. Expected: 2. Got: %d", version)
+	}
+	expected := []model.Route{{ID: "FOO", Index: 0}, {ID: "BAR", Index: 1}}
+	if !reflect.DeepEqual(rs, expected) {
+		t.Errorf("Routes mismatch. Expected: %v. Got: %v", expected, rs)
+	}
+}
+
+func TestWatchSendsEveryLaterRevisionInOrder(t *testing.T) {
+	srl := New()
+	srl.Append(model.Route{ID: "FOO"})
+	_, _, c, stop := srl.Watch()
+	defer stop()
+
+	srl.Append(model.Route{ID: "BAR"})
+	_ = srl.Delete("FOO")
+
+	for _, expected := range []struct {
+		version   int
+		operation string
+	}{{2, "append"}, {3, "delete"}} {
+		rev := <-c
+		if rev.Version != expected.version || rev.Operation != expected.operation {
+			t.Errorf("Unexpected revision: %v", rev)
+		}
+	}
+}
+
+func TestWatchClosesTheChannelOnStop(t *testing.T) {
+	srl := New()
+	_, _, c, stop := srl.Watch()
+
+	stop()
+	stop()
+	srl.Append(model.Route{ID: "FOO"})
+
+	if _, ok := <-c; ok {
+		t.Error("Channel not closed")
+	}
+}
+
+func TestWatchDropsTheWatchersFallingBehind(t *testing.T) {
+	srl := New()
+	_, _, c, stop := srl.Watch()
+	defer stop()
+
+	for i := 0; i < watchBuffer+1; i++ {
+		srl.Append(model.Route{})
+	}
+
+	n := 0
+	for range c {
+		n++
+	}
+	if n != watchBuffer {
+		t.Errorf("Expected %d revisions before being dropped. Got: %d", watchBuffer, n)
+	}
+}
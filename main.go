@@ -32,6 +32,7 @@ func main() {
 	kapowCmd.AddCommand(cmd.GetCmd)
 	kapowCmd.AddCommand(cmd.SetCmd)
 	kapowCmd.AddCommand(cmd.RouteCmd)
+	kapowCmd.AddCommand(cmd.HandlerCmd)
 
 	err := kapowCmd.Execute()
 	if err != nil {
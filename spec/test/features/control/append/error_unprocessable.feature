@@ -35,7 +35,7 @@ Feature: Kapow! server rejects requests with semantic errors.
       And I get the following response body:
       """
       {
-        "reason": "Invalid Route"
+        "reason": "Invalid Route: method is mandatory"
       }
       """
 
@@ -58,6 +58,6 @@ Feature: Kapow! server rejects requests with semantic errors.
       And I get the following response body:
       """
       {
-        "reason": "Invalid Route"
+        "reason": "Invalid Route: invalid url_pattern \"+123--\": mux: path must start with a slash, got \"+123--\""
       }
       """
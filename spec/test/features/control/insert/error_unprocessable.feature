@@ -71,6 +71,6 @@ Feature: Kapow! server rejects insertion requests with semantic errors.
       And I get the following response body:
       """
       {
-        "reason": "Invalid Route"
+        "reason": "Invalid Route: index must not be negative"
       }
       """